@@ -0,0 +1,94 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"game-server/internal/config"
+	"game-server/internal/game"
+	"game-server/internal/mapimage"
+	"log"
+	"os"
+	"time"
+)
+
+var (
+	configPath   = flag.String("config", "", "path to a JSON config file")
+	seed         = flag.Int64("seed", 0, "world seed; 0 picks a random one")
+	mapGenerator = flag.String("generator", "", "map generator: scatter, bsp or cave")
+	mapFile      = flag.String("map", "", "path to a hand-authored ASCII map or Tiled .json export")
+	mapWidth     = flag.Int("width", 0, "map width in tiles")
+	mapHeight    = flag.Int("height", 0, "map height in tiles")
+	floors       = flag.Int("floors", 0, "number of dungeon floors; 0 uses the config value")
+	floor        = flag.Int("floor", 0, "depth of the floor to export")
+	monsters     = flag.Int("monsters", -1, "number of monsters to place; -1 uses the config value")
+	outPath      = flag.String("o", "map.png", "output PNG file")
+	tileSize     = flag.Int("tile", 16, "pixels per tile, 1 to 64")
+	grid         = flag.Bool("grid", false, "draw a grid between tiles")
+)
+
+func main() {
+	flag.Parse()
+
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "seed":
+			cfg.Seed = *seed
+		case "generator":
+			cfg.MapGenerator = *mapGenerator
+		case "map":
+			cfg.MapFile = *mapFile
+		case "width":
+			cfg.MapWidth = *mapWidth
+		case "height":
+			cfg.MapHeight = *mapHeight
+		case "floors":
+			cfg.Floors = *floors
+		case "monsters":
+			cfg.InitialMonsterCount = *monsters
+		}
+	})
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid config: %v", err)
+	}
+	if *tileSize < 1 || *tileSize > 64 {
+		log.Fatalf("-tile must be between 1 and 64, got %d", *tileSize)
+	}
+	if cfg.Seed == 0 {
+		cfg.Seed = time.Now().UnixNano()
+	}
+
+	if *floor >= cfg.Floors {
+		cfg.Floors = *floor + 1
+	}
+	dungeon, err := game.BuildDungeon(cfg)
+	if err != nil {
+		log.Fatalf("Failed to build dungeon: %v", err)
+	}
+	world, ok := dungeon.Floor(*floor)
+	if !ok {
+		log.Fatalf("No floor %d", *floor)
+	}
+	tuning, err := game.TuningFromConfig(cfg)
+	if err != nil {
+		log.Fatalf("Failed to load tuning: %v", err)
+	}
+	world.ApplyTuning(tuning)
+	world.SpawnInitialMonsters(cfg.InitialMonsterCount)
+
+	out, err := os.Create(*outPath)
+	if err != nil {
+		log.Fatalf("Failed to create %s: %v", *outPath, err)
+	}
+	if err := mapimage.Encode(out, world, mapimage.Options{TileSize: *tileSize, Grid: *grid}); err != nil {
+		out.Close()
+		log.Fatalf("Failed to write %s: %v", *outPath, err)
+	}
+	if err := out.Close(); err != nil {
+		log.Fatalf("Failed to write %s: %v", *outPath, err)
+	}
+	fmt.Printf("Wrote %dx%d map of floor %d (seed %d) to %s\n", world.Width, world.Height, world.Depth, cfg.Seed, *outPath)
+}
@@ -1,68 +1,151 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"game-server/internal/config"
 	"game-server/internal/game"
 	"game-server/internal/server"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 )
 
-func initializeGame() (*config.Config, *game.World, error) {
+var (
+	configPath          = flag.String("config", "", "path to a JSON config file")
+	serverPort          = flag.String("port", "", "port to listen on")
+	mapWidth            = flag.Int("width", 0, "map width in tiles")
+	mapHeight           = flag.Int("height", 0, "map height in tiles")
+	floors              = flag.Int("floors", 0, "number of dungeon floors")
+	tickRate            = flag.Int("tick-rate", 0, "simulation ticks per second")
+	seed                = flag.Int64("seed", 0, "world seed; 0 picks a random one")
+	mapGenerator        = flag.String("generator", "", "map generator: scatter, bsp or cave")
+	mapFile             = flag.String("map", "", "path to a hand-authored ASCII map or Tiled .json export; replaces generation")
+	initialMonsterCount = flag.Int("monsters", 0, "number of monsters spawned at startup")
+	respawnDelay        = flag.Duration("respawn-delay", 0, "how long before a dead monster is replaced; 0s disables respawning")
+	combatTimeout       = flag.Duration("combat-timeout", 0, "end fights after this long without an attack; 0s never times out")
+	potionHealAmount    = flag.Int("potion-heal", 0, "HP restored by a potion")
+	tuningFile          = flag.String("tuning", "", "path to a JSON gameplay tuning file, re-read on SIGHUP")
+	monstersFile        = flag.String("monsters-file", "", "path to a JSON monster archetype file, re-read on SIGHUP")
+	writeWait           = flag.Duration("write-wait", 0, "websocket write deadline")
+	pongWait            = flag.Duration("pong-wait", 0, "websocket pong deadline")
+	maxMessageSize      = flag.Int64("max-message-size", 0, "maximum size of an incoming websocket message in bytes")
+	readBufferSize      = flag.Int("read-buffer", 0, "websocket read buffer size in bytes")
+	writeBufferSize     = flag.Int("write-buffer", 0, "websocket write buffer size in bytes")
+)
+
+// applyFlags overrides cfg with the flags that were explicitly set on the command line.
+func applyFlags(cfg *config.Config) {
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "port":
+			cfg.ServerPort = *serverPort
+		case "width":
+			cfg.MapWidth = *mapWidth
+		case "height":
+			cfg.MapHeight = *mapHeight
+		case "floors":
+			cfg.Floors = *floors
+		case "tick-rate":
+			cfg.TickRate = *tickRate
+		case "seed":
+			cfg.Seed = *seed
+		case "generator":
+			cfg.MapGenerator = *mapGenerator
+		case "map":
+			cfg.MapFile = *mapFile
+		case "monsters":
+			cfg.InitialMonsterCount = *initialMonsterCount
+		case "respawn-delay":
+			cfg.RespawnDelay = *respawnDelay
+		case "combat-timeout":
+			cfg.CombatTimeout = *combatTimeout
+		case "potion-heal":
+			cfg.PotionHealAmount = *potionHealAmount
+		case "tuning":
+			cfg.TuningFile = *tuningFile
+		case "monsters-file":
+			cfg.MonstersFile = *monstersFile
+		case "write-wait":
+			cfg.WriteWait = *writeWait
+		case "pong-wait":
+			cfg.PongWait = *pongWait
+		case "max-message-size":
+			cfg.MaxMessageSize = *maxMessageSize
+		case "read-buffer":
+			cfg.ReadBufferSize = *readBufferSize
+		case "write-buffer":
+			cfg.WriteBufferSize = *writeBufferSize
+		}
+	})
+}
+
+func initializeGame() (*config.Config, *game.Dungeon, error) {
 	fmt.Println("Initializing game...")
-	cfg, err := config.LoadConfig()
+	cfg, err := config.LoadConfig(*configPath)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to load config: %w", err)
 	}
-	fmt.Printf("Configuration loaded: ServerPort=%s, MapWidth=%d, MapHeight=%d\n", cfg.ServerPort, cfg.MapWidth, cfg.MapHeight)
+	applyFlags(cfg)
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, fmt.Errorf("invalid config: %w", err)
+	}
+	if cfg.Seed == 0 {
+		cfg.Seed = time.Now().UnixNano()
+	}
+	fmt.Printf("Configuration loaded: ServerPort=%s, MapWidth=%d, MapHeight=%d, Floors=%d, MapGenerator=%s, Seed=%d\n", cfg.ServerPort, cfg.MapWidth, cfg.MapHeight, cfg.Floors, cfg.MapGenerator, cfg.Seed)
 
-	world := game.NewWorld(cfg.MapWidth, cfg.MapHeight)
-	fmt.Printf("Game world initialized with %d x %d tiles.\n", world.Width, world.Height)
-	fmt.Println("Map:")
-	fmt.Println(world.String())
+	dungeon, err := game.BuildDungeon(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	tuning, err := game.TuningFromConfig(cfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load tuning: %w", err)
+	}
+	dungeon.ApplyTuning(tuning)
+	for _, floor := range dungeon.Floors {
+		fmt.Printf("Floor %d initialized with %d x %d tiles.\n", floor.Depth, floor.Width, floor.Height)
+		fmt.Println("Map:")
+		fmt.Println(floor.String())
+	}
 
-	return cfg, world, nil
+	return cfg, dungeon, nil
 }
 
 func main() {
+	flag.Parse()
 	fmt.Println("Starting game server...")
 
-	cfg, world, err := initializeGame()
+	cfg, dungeon, err := initializeGame()
 	if err != nil {
 		log.Fatalf("Failed during game initialization: %v", err)
 	}
 
-	log.Printf("Game initialized. Handing off to server module to listen on port %s.", cfg.ServerPort)
+	go reloadTuningOnSignal(cfg, dungeon)
 
-	// debugPrint(world)
+	log.Printf("Game initialized. Handing off to server module to listen on port %s.", cfg.ServerPort)
 
-	server.Start(world, cfg.ServerPort) // Start the server
+	server.Start(dungeon, cfg) // Start the server
 }
 
-func debugPrint(world *game.World) {
-	fmt.Print("\x1b[2J")         // Clear screen
-	fmt.Print("\x1b[?25l")       // Hide cursor
-	defer fmt.Print("\x1b[?25h") // Restore cursor
+func reloadTuningOnSignal(cfg *config.Config, dungeon *game.Dungeon) {
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
 
-	var frameCount int
-	var fps int
-	lastFPSUpdate := time.Now()
-
-	for {
-		frameCount++
-
-		now := time.Now()
-		if now.Sub(lastFPSUpdate) >= time.Second {
-			fps = frameCount
-			frameCount = 0
-			lastFPSUpdate = now
+	for range sighup {
+		if cfg.TuningFile == "" && cfg.MonstersFile == "" {
+			log.Printf("Received SIGHUP but no tuning or monsters file is configured. Ignoring.")
+			continue
 		}
-
-		// Draw output
-		fmt.Print("\x1b[H") // Move to top-left
-		fmt.Printf("FPS: %d\n", fps)
-		fmt.Printf("Frames (this second): %d\n", frameCount)
-		fmt.Println(world.String())
+		log.Printf("Received SIGHUP, reloading tuning (tuning file %q, monsters file %q)", cfg.TuningFile, cfg.MonstersFile)
+		tuning, err := game.TuningFromConfig(cfg)
+		if err != nil {
+			log.Printf("Failed to reload tuning, keeping current values: %v", err)
+			continue
+		}
+		dungeon.ApplyTuning(tuning)
 	}
 }
@@ -1,15 +1,389 @@
 package config
 
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Config holds every server setting. Values are layered: defaults, then the
+// optional config file, then GAME_* environment variables, then command-line
+// flags (applied by cmd/server).
 type Config struct {
 	ServerPort string
 	MapWidth   int
 	MapHeight  int
+	// Floors is the number of dungeon floors, joined by stairs.
+	Floors int
+	// TickRate is how many simulation ticks run per second.
+	TickRate int
+	// Seed drives all world randomness. Zero means pick one at startup.
+	Seed int64
+	// MapGenerator names the map generator: scatter, bsp or cave.
+	MapGenerator string
+	// MapFile is a hand-authored map: a Tiled JSON export when it ends in .json,
+	// an ASCII map otherwise. When set it replaces generation and its size
+	// overrides MapWidth and MapHeight.
+	MapFile string
+	// RespawnDelay is how long after a monster dies it is replaced; zero turns
+	// respawning off. Replacements appear at least RespawnMinPlayerDistance steps
+	// from every player.
+	RespawnDelay             time.Duration
+	RespawnMinPlayerDistance int
+	// MonsterTargets keeps that many monsters of each type alive on every floor, on
+	// top of InitialMonsterCount. RegionMonsterTargets does the same for the named
+	// regions of a Tiled map. Both are only settable from the config file.
+	MonsterTargets       map[string]int
+	RegionMonsterTargets map[string]int
+	// CombatTimeout ends a fight in which neither side has acted for this long.
+	// Zero lets fights last forever.
+	CombatTimeout time.Duration
+	// TiledGIDs maps Tiled tile GIDs to tile type names ("grass", "stone"). Only
+	// settable from the config file; nil uses the game's default table.
+	TiledGIDs map[uint32]string
+
+	InitialMonsterCount int
+	PotionHealAmount    int
+
+	// TuningFile holds gameplay values that are re-read on SIGHUP.
+	TuningFile string
+	// MonstersFile replaces the built-in monster archetypes. It is re-read on
+	// SIGHUP along with TuningFile, which is applied on top of it.
+	MonstersFile string
+
+	// AdminToken guards the /admin/ endpoints. They are disabled when it is empty.
+	AdminToken string
+
+	// Websocket settings
+	WriteWait       time.Duration
+	PongWait        time.Duration
+	MaxMessageSize  int64
+	ReadBufferSize  int
+	WriteBufferSize int
+}
+
+// fileConfig mirrors Config for the JSON config file. Pointer fields let us tell
+// "not set" apart from a zero value so only keys present in the file override.
+type fileConfig struct {
+	ServerPort               *string           `json:"server_port"`
+	MapWidth                 *int              `json:"map_width"`
+	Floors                   *int              `json:"floors"`
+	TickRate                 *int              `json:"tick_rate"`
+	MapHeight                *int              `json:"map_height"`
+	Seed                     *int64            `json:"seed"`
+	MapGenerator             *string           `json:"map_generator"`
+	MapFile                  *string           `json:"map_file"`
+	TiledGIDs                map[uint32]string `json:"tiled_gids"`
+	RespawnDelay             *string           `json:"respawn_delay"`
+	CombatTimeout            *string           `json:"combat_timeout"`
+	RespawnMinPlayerDistance *int              `json:"respawn_min_player_distance"`
+	MonsterTargets           map[string]int    `json:"monster_targets"`
+	RegionMonsterTargets     map[string]int    `json:"region_monster_targets"`
+	InitialMonsterCount      *int              `json:"initial_monster_count"`
+	PotionHealAmount         *int              `json:"potion_heal_amount"`
+	TuningFile               *string           `json:"tuning_file"`
+	MonstersFile             *string           `json:"monsters_file"`
+	AdminToken               *string           `json:"admin_token"`
+	WriteWait                *string           `json:"write_wait"`
+	PongWait                 *string           `json:"pong_wait"`
+	MaxMessageSize           *int64            `json:"max_message_size"`
+	ReadBufferSize           *int              `json:"read_buffer_size"`
+	WriteBufferSize          *int              `json:"write_buffer_size"`
 }
 
-func LoadConfig() (*Config, error) {
+func Default() *Config {
 	return &Config{
-		ServerPort: "8080",
-		MapWidth:   20,
-		MapHeight:  20,
-	}, nil
+		ServerPort:               "8080",
+		MapWidth:                 20,
+		MapHeight:                20,
+		Floors:                   3,
+		TickRate:                 10,
+		MapGenerator:             "scatter",
+		InitialMonsterCount:      5,
+		PotionHealAmount:         30,
+		RespawnDelay:             30 * time.Second,
+		RespawnMinPlayerDistance: 8,
+		CombatTimeout:            30 * time.Second,
+		WriteWait:                10 * time.Second,
+		PongWait:                 60 * time.Second,
+		MaxMessageSize:           512,
+		ReadBufferSize:           1024,
+		WriteBufferSize:          1024,
+	}
+}
+
+// LoadConfig builds a Config from the defaults, the config file at path (skipped
+// when path is empty) and GAME_* environment variables. Flags are applied on top
+// by the caller, which should call Validate once it is done.
+func LoadConfig(path string) (*Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		if err := cfg.LoadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cfg.ApplyEnv(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (c *Config) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file %s: %w", path, err)
+	}
+
+	var fc fileConfig
+	if err := json.Unmarshal(data, &fc); err != nil {
+		return fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+
+	if fc.ServerPort != nil {
+		c.ServerPort = *fc.ServerPort
+	}
+	if fc.MapWidth != nil {
+		c.MapWidth = *fc.MapWidth
+	}
+	if fc.MapHeight != nil {
+		c.MapHeight = *fc.MapHeight
+	}
+	if fc.Floors != nil {
+		c.Floors = *fc.Floors
+	}
+	if fc.TickRate != nil {
+		c.TickRate = *fc.TickRate
+	}
+	if fc.Seed != nil {
+		c.Seed = *fc.Seed
+	}
+	if fc.MapGenerator != nil {
+		c.MapGenerator = *fc.MapGenerator
+	}
+	if fc.MapFile != nil {
+		c.MapFile = *fc.MapFile
+	}
+	if fc.TiledGIDs != nil {
+		c.TiledGIDs = fc.TiledGIDs
+	}
+	if fc.RespawnDelay != nil {
+		if c.RespawnDelay, err = time.ParseDuration(*fc.RespawnDelay); err != nil {
+			return fmt.Errorf("config file %s: respawn_delay: %w", path, err)
+		}
+	}
+	if fc.CombatTimeout != nil {
+		if c.CombatTimeout, err = time.ParseDuration(*fc.CombatTimeout); err != nil {
+			return fmt.Errorf("config file %s: combat_timeout: %w", path, err)
+		}
+	}
+	if fc.RespawnMinPlayerDistance != nil {
+		c.RespawnMinPlayerDistance = *fc.RespawnMinPlayerDistance
+	}
+	if fc.MonsterTargets != nil {
+		c.MonsterTargets = fc.MonsterTargets
+	}
+	if fc.RegionMonsterTargets != nil {
+		c.RegionMonsterTargets = fc.RegionMonsterTargets
+	}
+	if fc.InitialMonsterCount != nil {
+		c.InitialMonsterCount = *fc.InitialMonsterCount
+	}
+	if fc.PotionHealAmount != nil {
+		c.PotionHealAmount = *fc.PotionHealAmount
+	}
+	if fc.TuningFile != nil {
+		c.TuningFile = *fc.TuningFile
+	}
+	if fc.MonstersFile != nil {
+		c.MonstersFile = *fc.MonstersFile
+	}
+	if fc.AdminToken != nil {
+		c.AdminToken = *fc.AdminToken
+	}
+	if fc.WriteWait != nil {
+		if c.WriteWait, err = time.ParseDuration(*fc.WriteWait); err != nil {
+			return fmt.Errorf("config file %s: write_wait: %w", path, err)
+		}
+	}
+	if fc.PongWait != nil {
+		if c.PongWait, err = time.ParseDuration(*fc.PongWait); err != nil {
+			return fmt.Errorf("config file %s: pong_wait: %w", path, err)
+		}
+	}
+	if fc.MaxMessageSize != nil {
+		c.MaxMessageSize = *fc.MaxMessageSize
+	}
+	if fc.ReadBufferSize != nil {
+		c.ReadBufferSize = *fc.ReadBufferSize
+	}
+	if fc.WriteBufferSize != nil {
+		c.WriteBufferSize = *fc.WriteBufferSize
+	}
+	return nil
+}
+
+// ApplyEnv overrides settings from GAME_* environment variables, e.g.
+// GAME_SERVER_PORT or GAME_PONG_WAIT=30s.
+func (c *Config) ApplyEnv() error {
+	if v, ok := os.LookupEnv("GAME_SERVER_PORT"); ok {
+		c.ServerPort = v
+	}
+	if err := envInt("GAME_MAP_WIDTH", &c.MapWidth); err != nil {
+		return err
+	}
+	if err := envInt("GAME_MAP_HEIGHT", &c.MapHeight); err != nil {
+		return err
+	}
+	if err := envInt("GAME_FLOORS", &c.Floors); err != nil {
+		return err
+	}
+	if err := envInt("GAME_TICK_RATE", &c.TickRate); err != nil {
+		return err
+	}
+	if v, ok := os.LookupEnv("GAME_SEED"); ok {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("GAME_SEED: %w", err)
+		}
+		c.Seed = n
+	}
+	if v, ok := os.LookupEnv("GAME_MAP_GENERATOR"); ok {
+		c.MapGenerator = v
+	}
+	if v, ok := os.LookupEnv("GAME_MAP_FILE"); ok {
+		c.MapFile = v
+	}
+	if err := envInt("GAME_INITIAL_MONSTER_COUNT", &c.InitialMonsterCount); err != nil {
+		return err
+	}
+	if err := envInt("GAME_POTION_HEAL_AMOUNT", &c.PotionHealAmount); err != nil {
+		return err
+	}
+	if v, ok := os.LookupEnv("GAME_TUNING_FILE"); ok {
+		c.TuningFile = v
+	}
+	if v, ok := os.LookupEnv("GAME_MONSTERS_FILE"); ok {
+		c.MonstersFile = v
+	}
+	if v, ok := os.LookupEnv("GAME_ADMIN_TOKEN"); ok {
+		c.AdminToken = v
+	}
+	if err := envDuration("GAME_RESPAWN_DELAY", &c.RespawnDelay); err != nil {
+		return err
+	}
+	if err := envInt("GAME_RESPAWN_MIN_PLAYER_DISTANCE", &c.RespawnMinPlayerDistance); err != nil {
+		return err
+	}
+	if err := envDuration("GAME_COMBAT_TIMEOUT", &c.CombatTimeout); err != nil {
+		return err
+	}
+	if err := envDuration("GAME_WRITE_WAIT", &c.WriteWait); err != nil {
+		return err
+	}
+	if err := envDuration("GAME_PONG_WAIT", &c.PongWait); err != nil {
+		return err
+	}
+	if v, ok := os.LookupEnv("GAME_MAX_MESSAGE_SIZE"); ok {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("GAME_MAX_MESSAGE_SIZE: %w", err)
+		}
+		c.MaxMessageSize = n
+	}
+	if err := envInt("GAME_READ_BUFFER_SIZE", &c.ReadBufferSize); err != nil {
+		return err
+	}
+	if err := envInt("GAME_WRITE_BUFFER_SIZE", &c.WriteBufferSize); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *Config) Validate() error {
+	if c.ServerPort == "" {
+		return fmt.Errorf("server port must not be empty")
+	}
+	if port, err := strconv.Atoi(c.ServerPort); err != nil || port <= 0 || port > 65535 {
+		return fmt.Errorf("invalid server port %q", c.ServerPort)
+	}
+	// The outer ring is always stone, so anything smaller has no walkable tiles.
+	if c.MapWidth < 3 || c.MapHeight < 3 {
+		return fmt.Errorf("map size must be at least 3x3, got %dx%d", c.MapWidth, c.MapHeight)
+	}
+	if c.Floors < 1 {
+		return fmt.Errorf("floors must be at least 1, got %d", c.Floors)
+	}
+	if c.TickRate < 1 || c.TickRate > 1000 {
+		return fmt.Errorf("tick rate must be between 1 and 1000, got %d", c.TickRate)
+	}
+	if c.InitialMonsterCount < 0 {
+		return fmt.Errorf("initial monster count must not be negative, got %d", c.InitialMonsterCount)
+	}
+	if c.PotionHealAmount <= 0 {
+		return fmt.Errorf("potion heal amount must be positive, got %d", c.PotionHealAmount)
+	}
+	if c.RespawnDelay < 0 || c.RespawnMinPlayerDistance < 0 {
+		return fmt.Errorf("respawn delay and minimum player distance must not be negative, got %s and %d", c.RespawnDelay, c.RespawnMinPlayerDistance)
+	}
+	if c.CombatTimeout < 0 {
+		return fmt.Errorf("combat timeout must not be negative, got %s", c.CombatTimeout)
+	}
+	for name, n := range c.MonsterTargets {
+		if n < 0 {
+			return fmt.Errorf("monster target for %s must not be negative, got %d", name, n)
+		}
+	}
+	for name, n := range c.RegionMonsterTargets {
+		if n < 0 {
+			return fmt.Errorf("monster target for region %s must not be negative, got %d", name, n)
+		}
+	}
+	if c.WriteWait <= 0 {
+		return fmt.Errorf("write wait must be positive, got %s", c.WriteWait)
+	}
+	// Pings go out every 9/10 of the pong wait and each one may take up to the
+	// write wait to send, so a shorter pong wait drops healthy clients.
+	if c.PongWait < time.Second {
+		return fmt.Errorf("pong wait must be at least 1s, got %s", c.PongWait)
+	}
+	if c.PongWait <= c.WriteWait {
+		return fmt.Errorf("pong wait (%s) must be longer than write wait (%s)", c.PongWait, c.WriteWait)
+	}
+	if c.MaxMessageSize <= 0 {
+		return fmt.Errorf("max message size must be positive, got %d", c.MaxMessageSize)
+	}
+	if c.ReadBufferSize <= 0 || c.WriteBufferSize <= 0 {
+		return fmt.Errorf("websocket buffer sizes must be positive, got read=%d write=%d", c.ReadBufferSize, c.WriteBufferSize)
+	}
+	return nil
+}
+
+func envInt(name string, dst *int) error {
+	v, ok := os.LookupEnv(name)
+	if !ok {
+		return nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	*dst = n
+	return nil
+}
+
+func envDuration(name string, dst *time.Duration) error {
+	v, ok := os.LookupEnv(name)
+	if !ok {
+		return nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	*dst = d
+	return nil
 }
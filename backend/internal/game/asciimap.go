@@ -0,0 +1,143 @@
+package game
+
+import (
+	"bufio"
+	"fmt"
+	"game-server/internal/protocol"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// MonsterSpawn marks where a monster is placed when the world is populated.
+// An empty Type means "pick one by spawn weight".
+type MonsterSpawn struct {
+	Type protocol.MonsterType
+	X, Y int
+}
+
+// LoadASCIIMapFile reads a hand-authored map. See LoadASCIIMap for the format.
+func LoadASCIIMapFile(path string, seed int64, monsters map[protocol.MonsterType]MonsterStats) (*World, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening map file %s: %w", path, err)
+	}
+	defer f.Close()
+
+	world, err := LoadASCIIMap(f, seed, monsters)
+	if err != nil {
+		return nil, fmt.Errorf("map file %s: %w", path, err)
+	}
+	return world, nil
+}
+
+// LoadASCIIMap builds a World from the same legend World.String() prints. Tiles use
+// the glyphs from the tile registry:
+//
+//	.  grass     ~  water     +  door     :  rubble     >  stairs down
+//	#  stone     ^  lava      =  bridge                 <  stairs up
+//
+// and these markers stand on grass:
+//
+//	M  monster spawn of a random type
+//	@  player spawn
+//
+// Any other glyph from the monsters table, such as g for goblins, marks a spawn of
+// that archetype; nil monsters uses the built-in table. Every row must have the
+// same width. Trailing blank lines are ignored. The map is used as drawn: no
+// connectivity repair is done.
+func LoadASCIIMap(r io.Reader, seed int64, monsters map[protocol.MonsterType]MonsterStats) (*World, error) {
+	if monsters == nil {
+		monsters = defaultMonsters
+	}
+	markers, err := monsterMarkers(monsters)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		rows = append(rows, strings.TrimRight(scanner.Text(), " \t\r"))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading map: %w", err)
+	}
+	for len(rows) > 0 && rows[len(rows)-1] == "" {
+		rows = rows[:len(rows)-1]
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("map is empty")
+	}
+
+	width := len(rows[0])
+	height := len(rows)
+	tiles := newTileGrid(width, height, protocol.Grass)
+	var playerSpawns []Point
+	var monsterSpawns []MonsterSpawn
+
+	for y, row := range rows {
+		if len(row) != width {
+			return nil, fmt.Errorf("line %d is %d characters wide, expected %d", y+1, len(row), width)
+		}
+		for x, glyph := range row {
+			if mType, ok := markers[glyph]; ok {
+				monsterSpawns = append(monsterSpawns, MonsterSpawn{Type: mType, X: x, Y: y})
+				continue
+			}
+			switch glyph {
+			case 'M':
+				monsterSpawns = append(monsterSpawns, MonsterSpawn{X: x, Y: y})
+			case '@':
+				playerSpawns = append(playerSpawns, Point{X: x, Y: y})
+			default:
+				tileType, ok := TileTypeByGlyph(glyph)
+				if !ok {
+					return nil, fmt.Errorf("line %d, column %d: unknown glyph %q", y+1, x+1, glyph)
+				}
+				tiles[y][x].Type = tileType
+			}
+		}
+	}
+
+	world := newWorldFromTiles(tiles, seed)
+	world.PlayerSpawns = playerSpawns
+	world.MonsterSpawns = monsterSpawns
+	world.computeReachable()
+	world.warnUnreachableSpawns()
+	return world, nil
+}
+
+// monsterMarkers maps each archetype's glyph to the archetype. M always means a
+// random type, so archetypes drawn as M can't be placed by glyph.
+func monsterMarkers(monsters map[protocol.MonsterType]MonsterStats) (map[rune]protocol.MonsterType, error) {
+	markers := make(map[rune]protocol.MonsterType)
+	for mType, stats := range monsters {
+		glyph, _ := utf8.DecodeRuneInString(stats.Glyph)
+		if glyph == 'M' {
+			continue
+		}
+		if other, ok := markers[glyph]; ok {
+			return nil, fmt.Errorf("monsters %s and %s share the glyph %q", min(other, mType), max(other, mType), glyph)
+		}
+		markers[glyph] = mType
+	}
+	return markers, nil
+}
+
+// warnUnreachableSpawns logs spawn markers that are cut off from the main region,
+// which is almost always a mistake in the map.
+func (w *World) warnUnreachableSpawns() {
+	for _, p := range w.PlayerSpawns {
+		if !w.IsReachable(p.X, p.Y) {
+			log.Printf("Warning: player spawn at (%d,%d) is not connected to the main area of the map.", p.X, p.Y)
+		}
+	}
+	for _, s := range w.MonsterSpawns {
+		if !w.IsReachable(s.X, s.Y) {
+			log.Printf("Warning: monster spawn at (%d,%d) is not connected to the main area of the map.", s.X, s.Y)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package game
+
+import (
+	"fmt"
+	"game-server/internal/config"
+	"game-server/internal/protocol"
+	"path/filepath"
+	"strings"
+)
+
+// BuildWorld creates the world described by cfg: loaded from cfg.MapFile when set,
+// generated otherwise.
+func BuildWorld(cfg *config.Config) (*World, error) {
+	if cfg.MapFile != "" {
+		var world *World
+		var err error
+		if strings.EqualFold(filepath.Ext(cfg.MapFile), ".json") {
+			gids, gidErr := tiledGIDs(cfg)
+			if gidErr != nil {
+				return nil, fmt.Errorf("invalid config: %w", gidErr)
+			}
+			world, err = LoadTiledMapFile(cfg.MapFile, cfg.Seed, gids)
+		} else {
+			var tuning *Tuning
+			tuning, err = TuningFromConfig(cfg)
+			if err != nil {
+				return nil, err
+			}
+			world, err = LoadASCIIMapFile(cfg.MapFile, cfg.Seed, tuning.Monsters)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to load map: %w", err)
+		}
+		return world, nil
+	}
+
+	gen, err := NewMapGenerator(cfg.MapGenerator)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	return NewWorld(cfg.MapWidth, cfg.MapHeight, cfg.Seed, gen), nil
+}
+
+func tiledGIDs(cfg *config.Config) (map[uint32]protocol.TileType, error) {
+	if cfg.TiledGIDs == nil {
+		return nil, nil
+	}
+	gids := make(map[uint32]protocol.TileType, len(cfg.TiledGIDs))
+	for gid, name := range cfg.TiledGIDs {
+		tileType, ok := TileTypeByName(name)
+		if !ok {
+			return nil, fmt.Errorf("tiled_gids: unknown tile type %q for GID %d", name, gid)
+		}
+		gids[gid] = tileType
+	}
+	return gids, nil
+}
+
+// TuningFromConfig starts from the built-in defaults (with the configured potion strength)
+// and overlays the tuning file, if there is one.
+func TuningFromConfig(cfg *config.Config) (*Tuning, error) {
+	base := DefaultTuning()
+	potion := base.Items[ItemHealingPotion]
+	potion.Heal = cfg.PotionHealAmount
+	base.Items[ItemHealingPotion] = potion
+	if cfg.MonstersFile != "" {
+		monsters, err := LoadMonsters(cfg.MonstersFile)
+		if err != nil {
+			return nil, err
+		}
+		base.Monsters = monsters
+	}
+	if cfg.TuningFile == "" {
+		// The monsters file may name effects that don't exist.
+		if err := base.Validate(); err != nil {
+			return nil, fmt.Errorf("monsters file %s: %w", cfg.MonstersFile, err)
+		}
+		return base, nil
+	}
+	return LoadTuning(cfg.TuningFile, base)
+}
+
+// BuildDungeon creates cfg.Floors floors. The top floor comes from cfg.MapFile when
+// it is set; every other floor is generated from a seed derived from cfg.Seed.
+func BuildDungeon(cfg *config.Config) (*Dungeon, error) {
+	gen, err := NewMapGenerator(cfg.MapGenerator)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	floors := make([]*World, cfg.Floors)
+	for depth := range floors {
+		if depth == 0 {
+			floors[0], err = BuildWorld(cfg)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		floors[depth] = NewWorld(cfg.MapWidth, cfg.MapHeight, cfg.Seed+int64(depth), gen)
+	}
+	for _, floor := range floors {
+		floor.TickRate = cfg.TickRate
+		floor.CombatTimeout = cfg.CombatTimeout
+	}
+	return NewDungeon(floors), nil
+}
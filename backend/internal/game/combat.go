@@ -0,0 +1,386 @@
+package game
+
+import (
+	"encoding/json"
+	"game-server/internal/protocol"
+	"log"
+	"slices"
+	"time"
+)
+
+// DefaultCombatTimeout ends a fight in which nobody has acted for this long.
+const DefaultCombatTimeout = 30 * time.Second
+
+// Reasons a combat session ends, sent to clients in S2C_CombatEndedPayload.
+const (
+	CombatEndMonsterDefeated = "monster_defeated"
+	CombatEndPlayerDefeated  = "player_defeated"
+	CombatEndPlayerLeft      = "player_left"
+	CombatEndMonsterRemoved  = "monster_removed"
+	CombatEndTimeout         = "timeout"
+	CombatEndFled            = "fled"
+)
+
+// fleeGrace is how long a monster leaves a player alone after they got away.
+const fleeGrace = 3 * time.Second
+
+// CombatSession is a fight between a monster and the players attacking it. It owns
+// the IsInCombat and CombatTargetID fields of everyone involved: they are only set
+// and cleared through StartCombatInternal, LeaveCombatInternal and EndCombatInternal.
+type CombatSession struct {
+	Monster *Monster
+	// Attackers in the order they joined.
+	Attackers []*Player
+	// Threat decides who the monster hits back, highest first. DamageDealt splits
+	// the XP when it dies. Both are keyed by player ID. Threat goes when a player
+	// leaves the fight; their damage counts until the session ends.
+	Threat      map[string]int
+	DamageDealt map[string]int
+	// Contributors are everyone who dealt damage, in the order they first did.
+	Contributors []*Player
+
+	StartedTick    uint64
+	LastActionTick uint64
+}
+
+func (s *CombatSession) HasAttacker(p *Player) bool {
+	for _, a := range s.Attackers {
+		if a == p {
+			return true
+		}
+	}
+	return false
+}
+
+// Target is the attacker with the most threat; ties go to whoever joined first.
+func (s *CombatSession) Target() *Player {
+	var target *Player
+	for _, a := range s.Attackers {
+		if target == nil || s.Threat[a.GetID()] > s.Threat[target.GetID()] {
+			target = a
+		}
+	}
+	return target
+}
+
+// RecordHit credits p with damage against the monster and the same amount of threat.
+func (s *CombatSession) RecordHit(p *Player, damage int) {
+	if damage > 0 && !slices.Contains(s.Contributors, p) {
+		s.Contributors = append(s.Contributors, p)
+	}
+	s.DamageDealt[p.GetID()] += damage
+	s.Threat[p.GetID()] += damage
+}
+
+func (s *CombatSession) attackerIDs() []string {
+	ids := make([]string, len(s.Attackers))
+	for i, a := range s.Attackers {
+		ids[i] = a.GetID()
+	}
+	return ids
+}
+
+// retarget points the monster at the current top of the threat table.
+func (s *CombatSession) retarget() {
+	if target := s.Target(); target != nil {
+		s.Monster.CombatTargetID = target.GetID()
+	} else {
+		s.Monster.CombatTargetID = ""
+	}
+}
+
+// StartCombatInternal puts p in combat with m, opening a fight or joining the one m
+// is already in, and tells the floor. Whoever started it, player or monster, the
+// clients see the same message.
+// Assumes w.Mu is HELD
+func (w *World) StartCombatInternal(p *Player, m *Monster) *CombatSession {
+	session := w.combats[m.GetID()]
+	if session == nil {
+		session = &CombatSession{
+			Monster:        m,
+			Threat:         make(map[string]int),
+			DamageDealt:    make(map[string]int),
+			StartedTick:    w.Tick,
+			LastActionTick: w.Tick,
+		}
+		w.combats[m.GetID()] = session
+		w.scheduleCombatTimeoutInternal(session, w.TicksFor(w.CombatTimeout))
+	}
+	if !session.HasAttacker(p) {
+		session.Attackers = append(session.Attackers, p)
+	}
+
+	p.IsInCombat = true
+	p.CombatTargetID = m.GetID()
+	m.IsInCombat = true
+	session.retarget()
+
+	log.Printf("Combat initiated: Player %s vs Monster %s (%s), %d attacker(s)", p.GetID(), m.GetID(), m.Name, len(session.Attackers))
+
+	w.broadcastInternal(protocol.S2C_MessageTypeCombatInitiated, protocol.S2C_CombatInitiatedPayload{
+		PlayerID:        p.GetID(),
+		MonsterID:       m.GetID(),
+		PlayerX:         p.GetX(),
+		PlayerY:         p.GetY(),
+		MonsterX:        m.GetX(),
+		MonsterY:        m.GetY(),
+		AttackerIDs:     session.attackerIDs(),
+		MonsterTargetID: m.CombatTargetID,
+	})
+	return session
+}
+
+// CombatSessionInternal returns the fight m is in, or nil.
+// Assumes w.Mu is HELD
+func (w *World) CombatSessionInternal(m *Monster) *CombatSession {
+	return w.combats[m.GetID()]
+}
+
+// playerCombatInternal returns the fight p is in, or nil.
+// Assumes w.Mu is HELD
+func (w *World) playerCombatInternal(p *Player) *CombatSession {
+	if session := w.combats[p.CombatTargetID]; session != nil && session.HasAttacker(p) {
+		return session
+	}
+	return nil
+}
+
+// RecordCombatActionInternal resets the inactivity timeout of session.
+// Assumes w.Mu is HELD
+func (w *World) RecordCombatActionInternal(session *CombatSession) {
+	session.LastActionTick = w.Tick
+}
+
+// LeaveCombatInternal takes p out of session and tells the floor why. The fight
+// ends when its last attacker leaves.
+// Assumes w.Mu is HELD
+func (w *World) LeaveCombatInternal(session *CombatSession, p *Player, reason string) {
+	i := slices.Index(session.Attackers, p)
+	if i < 0 {
+		return
+	}
+	session.Attackers = slices.Delete(session.Attackers, i, i+1)
+	delete(session.Threat, p.GetID())
+	if p.CombatTargetID == session.Monster.GetID() {
+		p.IsInCombat = false
+		p.CombatTargetID = ""
+	}
+
+	m := session.Monster
+	if len(session.Attackers) == 0 && w.combats[m.GetID()] == session {
+		delete(w.combats, m.GetID())
+		m.IsInCombat = false
+	}
+	session.retarget()
+
+	log.Printf("Player %s left combat with Monster %s (%s): %s", p.GetID(), m.GetID(), m.Name, reason)
+
+	w.broadcastInternal(protocol.S2C_MessageTypeCombatEnded, protocol.S2C_CombatEndedPayload{
+		PlayerID:        p.GetID(),
+		MonsterID:       m.GetID(),
+		Reason:          reason,
+		MonsterTargetID: m.CombatTargetID,
+	})
+}
+
+// EndCombatInternal ends the whole fight, taking every attacker out of it. Ending
+// a session twice is harmless.
+// Assumes w.Mu is HELD
+func (w *World) EndCombatInternal(session *CombatSession, reason string) {
+	for len(session.Attackers) > 0 {
+		w.LeaveCombatInternal(session, session.Attackers[0], reason)
+	}
+}
+
+// DefeatPlayerInternal takes a knocked out player out of any fight, clears their
+// status effects and sends them back to level 1.
+// Assumes w.Mu is HELD
+func (w *World) DefeatPlayerInternal(p *Player) {
+	if session := w.playerCombatInternal(p); session != nil {
+		w.LeaveCombatInternal(session, p, CombatEndPlayerDefeated)
+	}
+	w.clearEffectsInternal(p)
+	p.ResetToLevel1(w.Tuning)
+}
+
+// XPAward is one player's share of a defeated monster's XP.
+type XPAward struct {
+	Player    *Player
+	XP        int
+	LeveledUp bool
+}
+
+// AwardXPInternal splits the monster's XP between everyone who damaged it, by the
+// damage each dealt, and applies it. Contributors who have since disconnected or
+// left the floor forfeit their share; the rounding leftovers go to the biggest
+// contributor still here. Call it before ending the session.
+// Assumes w.Mu is HELD
+func (w *World) AwardXPInternal(session *CombatSession) []XPAward {
+	// A monster that died without taking a hit, such as to an effect, still
+	// rewards whoever was fighting it.
+	contributors := session.Contributors
+	if len(contributors) == 0 {
+		contributors = session.Attackers
+	}
+	total := 0
+	var present []*Player
+	var top *Player
+	for _, c := range contributors {
+		dealt := session.DamageDealt[c.GetID()]
+		total += dealt
+		// Players on other floors are guarded by another lock.
+		if w.Players[c.GetID()] != c {
+			continue
+		}
+		present = append(present, c)
+		if top == nil || dealt > session.DamageDealt[top.GetID()] {
+			top = c
+		}
+	}
+
+	xpValue := session.Monster.XPValue
+	shares := make(map[*Player]int, len(present))
+	given := 0
+	for _, c := range contributors {
+		share := 0
+		if total > 0 {
+			share = xpValue * session.DamageDealt[c.GetID()] / total
+		}
+		shares[c] = share
+		given += share
+	}
+	if top != nil {
+		shares[top] += xpValue - given
+	}
+
+	var awards []XPAward
+	for _, c := range present {
+		if shares[c] == 0 {
+			continue
+		}
+		leveledUp := c.GainXP(shares[c], w.Tuning)
+		awards = append(awards, XPAward{Player: c, XP: shares[c], LeveledUp: leveledUp})
+	}
+	return awards
+}
+
+// scheduleCombatTimeoutInternal checks session again after ticks, ending it if
+// nobody has acted for CombatTimeout by then.
+// Assumes w.Mu is HELD
+func (w *World) scheduleCombatTimeoutInternal(session *CombatSession, ticks uint64) {
+	if w.CombatTimeout <= 0 {
+		return
+	}
+	w.ScheduleInternal(ticks, func() {
+		if w.combats[session.Monster.GetID()] != session {
+			return
+		}
+		timeout := w.TicksFor(w.CombatTimeout)
+		idle := w.Tick - session.LastActionTick
+		if idle >= timeout {
+			// Otherwise a hunting monster next to them would start the same
+			// fight again on its next turn.
+			m := session.Monster
+			for _, p := range session.Attackers {
+				m.leaveAlone(p, w.Tick, w.Tick+timeout)
+			}
+			w.EndCombatInternal(session, CombatEndTimeout)
+			return
+		}
+		w.scheduleCombatTimeoutInternal(session, timeout-idle)
+	})
+}
+
+// FleeResult is the outcome of FleeInternal.
+type FleeResult struct {
+	Monster *Monster
+	Escaped bool
+	// Chance is the probability the attempt had of succeeding.
+	Chance float64
+	// Damage is what the monster's parting attack dealt after a failed attempt,
+	// and Defeated whether it knocked the player out.
+	Damage   int
+	Defeated bool
+	// Blocked is set when there was no free tile to run to; nothing else happened.
+	Blocked bool
+}
+
+// FleeInternal tries to get p out of its fight. On success p steps to the free
+// neighbouring tile furthest from the monster and leaves the fight; on failure the
+// monster gets a free attack on p and the fight goes on. ok is false if p isn't
+// fighting anything.
+// Assumes w.Mu is HELD
+func (w *World) FleeInternal(p *Player) (result FleeResult, ok bool) {
+	session := w.playerCombatInternal(p)
+	if session == nil {
+		return FleeResult{}, false
+	}
+	m := session.Monster
+	result.Monster = m
+
+	escape, found := w.fleeTile(p, m)
+	if !found {
+		result.Blocked = true
+		return result, true
+	}
+
+	result.Chance = w.Tuning.FleeBaseChance + w.Tuning.FleeChancePerPoint*float64(p.EffectiveDefense()-m.EffectiveAttack())
+	result.Chance = min(max(result.Chance, 0.05), 0.95)
+	w.RecordCombatActionInternal(session)
+
+	if w.rng.Float64() < result.Chance {
+		result.Escaped = true
+		w.LeaveCombatInternal(session, p, CombatEndFled)
+		w.occupied.movePlayer(p, escape.X, escape.Y)
+		// Only p gets away: the monster keeps fighting anyone else in the session.
+		m.leaveAlone(p, w.Tick, w.Tick+w.TicksFor(fleeGrace))
+		log.Printf("Player %s fled from Monster %s to (%d,%d).", p.GetID(), m.GetID(), escape.X, escape.Y)
+		return result, true
+	}
+
+	parting := w.ResolveAttackInternal(m, p)
+	result.Damage = parting.Damage
+	result.Defeated = p.TakeDamage(result.Damage)
+	log.Printf("Player %s failed to flee from Monster %s and took %d damage.", p.GetID(), m.GetID(), result.Damage)
+	if result.Defeated {
+		w.DefeatPlayerInternal(p)
+	} else if parting.Hit {
+		w.ApplyOnHitEffectsInternal(m, p)
+	}
+	return result, true
+}
+
+// fleeTile picks the free, harmless neighbour of p furthest from m.
+// Assumes w.Mu is HELD
+func (w *World) fleeTile(p *Player, m *Monster) (Point, bool) {
+	var best Point
+	bestDist := -1
+	for _, off := range neighbourOffsets {
+		next := Point{X: p.X + off.X, Y: p.Y + off.Y}
+		if !w.isSafeSpawn(next.X, next.Y) || w.IsOccupiedInternal(next.X, next.Y) {
+			continue
+		}
+		if dist := manhattan(next, Point{X: m.X, Y: m.Y}); dist > bestDist {
+			best, bestDist = next, dist
+		}
+	}
+	return best, bestDist >= 0
+}
+
+// broadcastInternal sends a message to the clients on this floor, if a hub is set.
+// Assumes w.Mu is HELD
+func (w *World) broadcastInternal(msgType string, payload interface{}) {
+	if w.hub == nil {
+		return
+	}
+	msg := protocol.GenericMessage{
+		Type:    msgType,
+		Payload: payload,
+	}
+	jsonMsg, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("Error marshaling %s message: %v", msgType, err)
+		return
+	}
+	w.hub.Broadcast(jsonMsg)
+}
@@ -0,0 +1,202 @@
+package game
+
+import (
+	"game-server/internal/protocol"
+	"sort"
+)
+
+// Walkable regions smaller than this are filled in rather than connected.
+const minConnectedRegionSize = 6
+
+type Point struct {
+	X, Y int
+}
+
+var neighbourOffsets = [4]Point{{0, -1}, {0, 1}, {-1, 0}, {1, 0}}
+
+// findRegions flood-fills the walkable tiles and returns the connected regions,
+// largest first.
+func (w *World) findRegions() [][]Point {
+	seen := make([]bool, w.Width*w.Height)
+	var regions [][]Point
+
+	for y := 0; y < w.Height; y++ {
+		for x := 0; x < w.Width; x++ {
+			if seen[y*w.Width+x] || !w.IsWalkable(x, y) {
+				continue
+			}
+
+			var region []Point
+			queue := []Point{{x, y}}
+			seen[y*w.Width+x] = true
+			for len(queue) > 0 {
+				p := queue[0]
+				queue = queue[1:]
+				region = append(region, p)
+				for _, d := range neighbourOffsets {
+					nx, ny := p.X+d.X, p.Y+d.Y
+					if !w.IsWalkable(nx, ny) || seen[ny*w.Width+nx] {
+						continue
+					}
+					seen[ny*w.Width+nx] = true
+					queue = append(queue, Point{nx, ny})
+				}
+			}
+			regions = append(regions, region)
+		}
+	}
+
+	sort.SliceStable(regions, func(i, j int) bool { return len(regions[i]) > len(regions[j]) })
+	return regions
+}
+
+// RepairConnectivity makes every walkable tile reachable from every other one.
+// Regions smaller than minRegionSize are turned into stone; larger ones get a
+// tunnel dug to the largest region.
+func (w *World) RepairConnectivity(minRegionSize int) {
+	for {
+		regions := w.findRegions()
+		if len(regions) <= 1 {
+			break
+		}
+
+		main := regions[0]
+		other := regions[len(regions)-1]
+		if len(other) < minRegionSize {
+			for _, p := range other {
+				w.Tiles[p.Y][p.X].Type = protocol.Stone
+			}
+			continue
+		}
+		if !w.tunnel(other, main) {
+			for _, p := range other {
+				w.Tiles[p.Y][p.X].Type = protocol.Stone
+			}
+		}
+	}
+	w.computeReachable()
+}
+
+// tunnel digs the shortest path of grass from any tile of from to any tile of to.
+// The outer border is never dug through. It reports false if no path exists.
+func (w *World) tunnel(from, to []Point) bool {
+	target := make([]bool, w.Width*w.Height)
+	for _, p := range to {
+		target[p.Y*w.Width+p.X] = true
+	}
+
+	prev := make([]int, w.Width*w.Height)
+	for i := range prev {
+		prev[i] = -2 // unvisited
+	}
+	queue := make([]Point, 0, len(from))
+	for _, p := range from {
+		prev[p.Y*w.Width+p.X] = -1 // start
+		queue = append(queue, p)
+	}
+
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		for _, d := range neighbourOffsets {
+			nx, ny := p.X+d.X, p.Y+d.Y
+			if nx < 0 || ny < 0 || nx >= w.Width || ny >= w.Height || isBorder(nx, ny, w.Width, w.Height) {
+				continue
+			}
+			idx := ny*w.Width + nx
+			if prev[idx] != -2 {
+				continue
+			}
+			prev[idx] = p.Y*w.Width + p.X
+			if target[idx] {
+				for i := prev[idx]; i >= 0; i = prev[i] {
+					w.Tiles[i/w.Width][i%w.Width].Type = protocol.Grass
+				}
+				return true
+			}
+			queue = append(queue, Point{nx, ny})
+		}
+	}
+	return false
+}
+
+// computeReachable records the largest walkable region. Spawns are only picked from
+// it so nobody starts in a pocket the rest of the map can't reach.
+func (w *World) computeReachable() {
+	w.reachable = make([]bool, w.Width*w.Height)
+	w.reachableTiles = nil
+
+	regions := w.findRegions()
+	if len(regions) == 0 {
+		return
+	}
+	w.reachableTiles = regions[0]
+	for _, p := range regions[0] {
+		w.reachable[p.Y*w.Width+p.X] = true
+	}
+}
+
+// LargestRegion returns the tiles of the largest connected walkable region.
+func (w *World) LargestRegion() []Point {
+	return w.reachableTiles
+}
+
+func (w *World) IsReachable(x, y int) bool {
+	if x < 0 || x >= w.Width || y < 0 || y >= w.Height {
+		return false
+	}
+	return w.reachable[y*w.Width+x]
+}
+
+// findFreeTileNear returns the closest safe, unoccupied tile to (x, y) that can be
+// walked to from it, (x, y) itself included.
+// Assumes w.Mu is HELD
+func (w *World) findFreeTileNear(x, y int) (int, int, bool) {
+	if w.GetTile(x, y) == nil {
+		return 0, 0, false
+	}
+	seen := make([]bool, w.Width*w.Height)
+	seen[y*w.Width+x] = true
+	queue := []Point{{x, y}}
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		if w.isSafeSpawn(p.X, p.Y) && !w.IsOccupiedInternal(p.X, p.Y) {
+			return p.X, p.Y, true
+		}
+		for _, d := range neighbourOffsets {
+			nx, ny := p.X+d.X, p.Y+d.Y
+			if !w.IsWalkable(nx, ny) || seen[ny*w.Width+nx] {
+				continue
+			}
+			seen[ny*w.Width+nx] = true
+			queue = append(queue, Point{nx, ny})
+		}
+	}
+	return 0, 0, false
+}
+
+// findFreeReachableTile picks a random unoccupied tile of the largest region.
+// Assumes w.Mu is HELD
+func (w *World) findFreeReachableTile() (x, y int, ok bool) {
+	if len(w.reachableTiles) == 0 {
+		return 0, 0, false
+	}
+
+	// Random probes first; fall back to a scan from a random offset so a crowded
+	// map still finds the last free tile.
+	for i := 0; i < 32; i++ {
+		p := w.reachableTiles[w.rng.Intn(len(w.reachableTiles))]
+		if w.isSafeSpawn(p.X, p.Y) && !w.IsOccupiedInternal(p.X, p.Y) {
+			return p.X, p.Y, true
+		}
+	}
+	start := w.rng.Intn(len(w.reachableTiles))
+	for i := range w.reachableTiles {
+		p := w.reachableTiles[(start+i)%len(w.reachableTiles)]
+		if w.isSafeSpawn(p.X, p.Y) && !w.IsOccupiedInternal(p.X, p.Y) {
+			return p.X, p.Y, true
+		}
+	}
+	return 0, 0, false
+}
@@ -0,0 +1,69 @@
+package game
+
+import "fmt"
+
+type DamageType string
+
+const (
+	DamagePhysical DamageType = "physical"
+	DamageFire     DamageType = "fire"
+	DamageFrost    DamageType = "frost"
+	DamagePoison   DamageType = "poison"
+)
+
+func (d DamageType) Valid() bool {
+	switch d {
+	case DamagePhysical, DamageFire, DamageFrost, DamagePoison:
+		return true
+	}
+	return false
+}
+
+// How well a hit went against the defender's resistances, sent to clients.
+const (
+	EffectivenessImmune   = "immune"
+	EffectivenessResisted = "resisted"
+	EffectivenessNormal   = "normal"
+	EffectivenessWeak     = "weak"
+)
+
+// Resistances cut damage of a type by a fraction: 0.5 halves it, 1 makes the
+// defender immune and -0.5 is a weakness that adds half again. Missing types are 0.
+type Resistances map[DamageType]float64
+
+// Multiplier is what damage of type d is multiplied by.
+func (r Resistances) Multiplier(d DamageType) float64 {
+	return max(1-r[d], 0)
+}
+
+func (r Resistances) Effectiveness(d DamageType) string {
+	switch m := r.Multiplier(d); {
+	case m == 0:
+		return EffectivenessImmune
+	case m < 1:
+		return EffectivenessResisted
+	case m > 1:
+		return EffectivenessWeak
+	}
+	return EffectivenessNormal
+}
+
+func (r Resistances) validate() error {
+	for d, v := range r {
+		if !d.Valid() {
+			return fmt.Errorf("unknown damage type %q", d)
+		}
+		if v < -1 || v > 1 {
+			return fmt.Errorf("resistance to %s must be between -1 and 1, got %v", d, v)
+		}
+	}
+	return nil
+}
+
+// Combatant is a player or monster as far as attack rolls are concerned.
+type Combatant interface {
+	EffectiveAttack() int
+	EffectiveDefense() int
+	AttackDamageType() DamageType
+	DamageResistances() Resistances
+}
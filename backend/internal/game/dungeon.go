@@ -0,0 +1,148 @@
+package game
+
+import (
+	"game-server/internal/protocol"
+	"log"
+	"sync"
+)
+
+// Dungeon is a stack of floors. Floor i's down stairs lead to floor i+1's up stairs.
+// Each floor is a separate World with its own lock.
+type Dungeon struct {
+	Floors []*World
+
+	// moves is held while a player changes floor or leaves the dungeon, so that
+	// RemovePlayer never runs while a player is between floors. Take it before
+	// any floor's Mu.
+	moves sync.Mutex
+}
+
+// NewDungeon numbers the floors by depth and makes sure every pair of neighbouring
+// floors is joined by stairs. Stairs already drawn on a floor are kept.
+func NewDungeon(floors []*World) *Dungeon {
+	for depth, floor := range floors {
+		floor.Depth = depth
+		if depth > 0 {
+			floor.ensureStairs(protocol.StairsUp)
+		}
+		if depth < len(floors)-1 {
+			floor.ensureStairs(protocol.StairsDown)
+		}
+	}
+	return &Dungeon{Floors: floors}
+}
+
+func (d *Dungeon) Floor(depth int) (*World, bool) {
+	if depth < 0 || depth >= len(d.Floors) {
+		return nil, false
+	}
+	return d.Floors[depth], true
+}
+
+func (d *Dungeon) ApplyTuning(t *Tuning) {
+	for _, floor := range d.Floors {
+		floor.ApplyTuning(t)
+	}
+}
+
+// RemovePlayer removes the player from whichever floor it is on and returns that
+// floor, or nil if the player wasn't found.
+func (d *Dungeon) RemovePlayer(playerID string) *World {
+	d.moves.Lock()
+	defer d.moves.Unlock()
+	for _, floor := range d.Floors {
+		floor.Mu.Lock()
+		_, ok := floor.Players[playerID]
+		floor.Mu.Unlock()
+		if ok {
+			floor.RemovePlayer(playerID)
+			return floor
+		}
+	}
+	return nil
+}
+
+// UseStairs moves p from the stairs it is standing on in from to the matching
+// stairs on the next or previous floor, or the nearest free tile if those are
+// taken. It returns the new floor, or false if p is not on usable stairs or has
+// already left from.
+func (d *Dungeon) UseStairs(p *Player, from *World) (*World, bool) {
+	d.moves.Lock()
+	defer d.moves.Unlock()
+
+	from.Mu.Lock()
+	tile := from.GetTile(p.X, p.Y)
+	if tile == nil || p.IsInCombat || from.Players[p.GetID()] != p {
+		from.Mu.Unlock()
+		return nil, false
+	}
+	var to *World
+	var arrival protocol.TileType
+	switch tile.Type {
+	case protocol.StairsDown:
+		to, _ = d.Floor(from.Depth + 1)
+		arrival = protocol.StairsUp
+	case protocol.StairsUp:
+		to, _ = d.Floor(from.Depth - 1)
+		arrival = protocol.StairsDown
+	}
+	if to == nil {
+		from.Mu.Unlock()
+		return nil, false
+	}
+	fromX, fromY, fromTick := p.X, p.Y, from.Tick
+	from.removePlayerInternal(p.GetID())
+	from.Mu.Unlock()
+
+	to.Mu.Lock()
+	var x, y int
+	var ok bool
+	if stairs, found := to.findTile(arrival); found {
+		x, y, ok = to.findFreeTileNear(stairs.X, stairs.Y)
+	} else {
+		x, y, ok = to.findFreeReachableTile()
+	}
+	if ok {
+		p.X, p.Y = x, y
+		p.Effects.rebase(fromTick, to.Tick)
+		to.AddPlayer(p)
+	}
+	to.Mu.Unlock()
+
+	if !ok {
+		log.Printf("Player %s could not take the stairs to floor %d: no free tile near the stairs.", p.GetID(), to.Depth)
+		from.Mu.Lock()
+		p.X, p.Y = fromX, fromY
+		from.AddPlayer(p)
+		from.Mu.Unlock()
+		return nil, false
+	}
+
+	log.Printf("Player %s took the stairs from floor %d to floor %d, arriving at (%d,%d).", p.GetID(), from.Depth, to.Depth, x, y)
+	return to, true
+}
+
+func (w *World) findTile(t protocol.TileType) (Point, bool) {
+	for y := 0; y < w.Height; y++ {
+		for x := 0; x < w.Width; x++ {
+			if w.Tiles[y][x].Type == t {
+				return Point{X: x, Y: y}, true
+			}
+		}
+	}
+	return Point{}, false
+}
+
+// ensureStairs places a staircase of type t on a random reachable tile unless the
+// floor already has one.
+func (w *World) ensureStairs(t protocol.TileType) {
+	if _, ok := w.findTile(t); ok {
+		return
+	}
+	x, y, ok := w.findFreeReachableTile()
+	if !ok {
+		log.Printf("Floor %d has no free tile for %s.", w.Depth, TileProps(t).Name)
+		return
+	}
+	w.Tiles[y][x].Type = t
+}
@@ -0,0 +1,318 @@
+package game
+
+import (
+	"fmt"
+	"game-server/internal/protocol"
+	"log"
+	"maps"
+	"math"
+	"slices"
+	"time"
+)
+
+type EffectID string
+
+// Stacking rules for an effect applied to someone who already has it.
+const (
+	// StackRefresh restarts the running effect's duration.
+	StackRefresh = "refresh"
+	// StackAdd adds a stack, up to MaxStacks, and restarts the duration.
+	StackAdd = "stack"
+	// StackIgnore leaves the running effect alone.
+	StackIgnore = "ignore"
+)
+
+// EffectDef describes a timed status effect. Damage, healing and stat modifiers
+// are multiplied by the number of stacks.
+type EffectDef struct {
+	Name       string `json:"name"`
+	DurationMs int    `json:"duration_ms"`
+	// IntervalMs is the time between ticks of DamagePerTick and HealPerTick.
+	IntervalMs    int `json:"interval_ms"`
+	DamagePerTick int `json:"damage_per_tick"`
+	HealPerTick   int `json:"heal_per_tick"`
+	// DamageType lets resistances reduce DamagePerTick; empty ignores them.
+	DamageType DamageType `json:"damage_type"`
+	// Stun makes the affected skip its turns.
+	Stun       bool `json:"stun"`
+	AttackMod  int  `json:"attack_mod"`
+	DefenseMod int  `json:"defense_mod"`
+	// Stacking is one of the Stack rules; empty means refresh.
+	Stacking  string `json:"stacking"`
+	MaxStacks int    `json:"max_stacks"`
+}
+
+// OnHitEffect gives a monster's attacks that land a Chance to apply Effect.
+type OnHitEffect struct {
+	Effect EffectID `json:"effect"`
+	Chance float64  `json:"chance"`
+}
+
+func defaultEffects() map[EffectID]EffectDef {
+	return map[EffectID]EffectDef{
+		"poison":       {Name: "Poison", DurationMs: 6000, IntervalMs: 1000, DamagePerTick: 2, DamageType: DamagePoison, Stacking: StackAdd, MaxStacks: 3},
+		"stun":         {Name: "Stunned", DurationMs: 1500, Stun: true, Stacking: StackIgnore},
+		"regeneration": {Name: "Regeneration", DurationMs: 10000, IntervalMs: 1000, HealPerTick: 3, Stacking: StackRefresh},
+		"weakness":     {Name: "Weakened", DurationMs: 8000, AttackMod: -3, Stacking: StackRefresh},
+		"strength":     {Name: "Strength", DurationMs: 15000, AttackMod: 4, Stacking: StackRefresh},
+		"fortify":      {Name: "Fortified", DurationMs: 15000, DefenseMod: 4, Stacking: StackRefresh},
+	}
+}
+
+func (d EffectDef) validate() error {
+	if d.DurationMs <= 0 {
+		return fmt.Errorf("duration_ms must be positive, got %d", d.DurationMs)
+	}
+	if d.IntervalMs < 0 || d.DamagePerTick < 0 || d.HealPerTick < 0 || d.MaxStacks < 0 {
+		return fmt.Errorf("interval_ms, damage_per_tick, heal_per_tick and max_stacks must not be negative")
+	}
+	if (d.DamagePerTick > 0 || d.HealPerTick > 0) && d.IntervalMs == 0 {
+		return fmt.Errorf("interval_ms is needed for damage or healing over time")
+	}
+	if d.DamageType != "" && !d.DamageType.Valid() {
+		return fmt.Errorf("unknown damage_type %q", d.DamageType)
+	}
+	switch d.Stacking {
+	case "", StackRefresh, StackAdd, StackIgnore:
+	default:
+		return fmt.Errorf("unknown stacking rule %q", d.Stacking)
+	}
+	return nil
+}
+
+// ActiveEffect is an effect currently on a player or monster. It keeps a copy of
+// its definition so a tuning reload doesn't change effects already running.
+type ActiveEffect struct {
+	ID       EffectID
+	Def      EffectDef
+	Stacks   int
+	SourceID string
+
+	ExpiresTick uint64
+	nextTick    uint64
+}
+
+// Effects are the effects on one player or monster, oldest first.
+type Effects []*ActiveEffect
+
+func (e Effects) Stunned() bool {
+	for _, effect := range e {
+		if effect.Def.Stun {
+			return true
+		}
+	}
+	return false
+}
+
+func (e Effects) AttackMod() int {
+	mod := 0
+	for _, effect := range e {
+		mod += effect.Def.AttackMod * effect.Stacks
+	}
+	return mod
+}
+
+func (e Effects) DefenseMod() int {
+	mod := 0
+	for _, effect := range e {
+		mod += effect.Def.DefenseMod * effect.Stacks
+	}
+	return mod
+}
+
+// rebase moves the effects' schedule from one floor's tick counter to another's.
+func (e Effects) rebase(from, to uint64) {
+	for _, effect := range e {
+		effect.ExpiresTick = effect.ExpiresTick - from + to
+		effect.nextTick = effect.nextTick - from + to
+	}
+}
+
+func (e Effects) find(id EffectID) *ActiveEffect {
+	for _, effect := range e {
+		if effect.ID == id {
+			return effect
+		}
+	}
+	return nil
+}
+
+// EffectTarget is a player or monster that status effects can be put on.
+type EffectTarget interface {
+	GetID() string
+	DamageResistances() Resistances
+	TakeDamage(amount int) bool
+	Heal(amount int) int
+	effectList() *Effects
+	entityType() string
+	currentHP() int
+}
+
+// ApplyEffectInternal puts effect id on target, or stacks or refreshes it according
+// to its definition, and tells the floor. It returns false for an unknown effect or
+// one that was ignored.
+// Assumes w.Mu is HELD
+func (w *World) ApplyEffectInternal(target EffectTarget, id EffectID, sourceID string) bool {
+	def, ok := w.Tuning.Effects[id]
+	if !ok {
+		log.Printf("Unknown effect %q for %s.", id, target.GetID())
+		return false
+	}
+	duration := w.TicksFor(msDuration(def.DurationMs))
+
+	effects := target.effectList()
+	effect := effects.find(id)
+	switch {
+	case effect == nil:
+		effect = &ActiveEffect{ID: id, Def: def, Stacks: 1}
+		if def.IntervalMs > 0 {
+			effect.nextTick = w.Tick + w.TicksFor(msDuration(def.IntervalMs))
+		}
+		*effects = append(*effects, effect)
+	case def.Stacking == StackIgnore:
+		return false
+	case def.Stacking == StackAdd:
+		effect.Stacks = min(effect.Stacks+1, max(def.MaxStacks, 1))
+	}
+	effect.SourceID = sourceID
+	effect.ExpiresTick = w.Tick + duration
+
+	log.Printf("%s %s is affected by %s (x%d).", target.entityType(), target.GetID(), def.Name, effect.Stacks)
+	w.broadcastInternal(protocol.S2C_MessageTypeEffectApplied, protocol.S2C_EffectAppliedPayload{
+		EntityID:   target.GetID(),
+		EntityType: target.entityType(),
+		EffectID:   string(id),
+		Name:       def.Name,
+		SourceID:   sourceID,
+		Stacks:     effect.Stacks,
+		DurationMs: def.DurationMs,
+	})
+	w.statModsChangedInternal(target, def)
+	return true
+}
+
+// ApplyOnHitEffectsInternal rolls the on-hit effects of m against p after one of
+// its attacks landed.
+// Assumes w.Mu is HELD
+func (w *World) ApplyOnHitEffectsInternal(m *Monster, p *Player) {
+	for _, onHit := range m.OnHit {
+		if w.rng.Float64() < onHit.Chance {
+			w.ApplyEffectInternal(p, onHit.Effect, m.GetID())
+		}
+	}
+}
+
+// clearEffectsInternal removes every effect from target, telling the floor.
+// Assumes w.Mu is HELD
+func (w *World) clearEffectsInternal(target EffectTarget) {
+	effects := target.effectList()
+	for len(*effects) > 0 {
+		w.expireEffectInternal(target, (*effects)[0])
+	}
+}
+
+// Assumes w.Mu is HELD
+func (w *World) expireEffectInternal(target EffectTarget, effect *ActiveEffect) {
+	effects := target.effectList()
+	if i := slices.Index(*effects, effect); i >= 0 {
+		*effects = slices.Delete(*effects, i, i+1)
+	}
+	w.broadcastInternal(protocol.S2C_MessageTypeEffectExpired, protocol.S2C_EffectExpiredPayload{
+		EntityID:   target.GetID(),
+		EntityType: target.entityType(),
+		EffectID:   string(effect.ID),
+	})
+	w.statModsChangedInternal(target, effect.Def)
+}
+
+// statModsChangedInternal sends a player's new effective stats after an effect
+// that modifies them came or went.
+// Assumes w.Mu is HELD
+func (w *World) statModsChangedInternal(target EffectTarget, def EffectDef) {
+	if p, ok := target.(*Player); ok && (def.AttackMod != 0 || def.DefenseMod != 0) {
+		w.broadcastInternal(protocol.S2C_MessageTypePlayerStatUpdate, p.StatUpdatePayload())
+	}
+}
+
+// tickEffectsInternal runs one simulation step of every active effect: players in
+// ID order first, then monsters.
+// Assumes w.Mu is HELD
+func (w *World) tickEffectsInternal() {
+	for _, id := range slices.Sorted(maps.Keys(w.Players)) {
+		w.tickTargetEffectsInternal(w.Players[id])
+	}
+	for _, m := range slices.Clone(w.monsterOrder) {
+		if w.Monsters[m.ID] == m {
+			w.tickTargetEffectsInternal(m)
+		}
+	}
+}
+
+// Assumes w.Mu is HELD
+func (w *World) tickTargetEffectsInternal(target EffectTarget) {
+	for _, effect := range slices.Clone(*target.effectList()) {
+		def := effect.Def
+		if def.IntervalMs > 0 && w.Tick >= effect.nextTick {
+			effect.nextTick = w.Tick + w.TicksFor(msDuration(def.IntervalMs))
+
+			damage := def.DamagePerTick * effect.Stacks
+			if def.DamageType != "" {
+				damage = int(math.Round(float64(damage) * target.DamageResistances().Multiplier(def.DamageType)))
+			}
+			defeated := damage > 0 && target.TakeDamage(damage)
+			healed := 0
+			if !defeated {
+				healed = target.Heal(def.HealPerTick * effect.Stacks)
+			}
+			if damage > 0 || healed > 0 {
+				w.broadcastInternal(protocol.S2C_MessageTypeEffectTick, protocol.S2C_EffectTickPayload{
+					EntityID:   target.GetID(),
+					EntityType: target.entityType(),
+					EffectID:   string(effect.ID),
+					Damage:     damage,
+					Healing:    healed,
+					CurrentHP:  target.currentHP(),
+					IsDefeated: defeated,
+				})
+			}
+			if defeated {
+				w.defeatByEffectInternal(target, effect)
+				return
+			}
+		}
+		if w.Tick >= effect.ExpiresTick {
+			w.expireEffectInternal(target, effect)
+		}
+	}
+}
+
+// defeatByEffectInternal handles a player or monster killed by damage over time.
+// A monster's attackers still get its XP and it still drops its loot.
+// Assumes w.Mu is HELD
+func (w *World) defeatByEffectInternal(target EffectTarget, effect *ActiveEffect) {
+	switch t := target.(type) {
+	case *Player:
+		log.Printf("Player %s succumbed to %s.", t.GetID(), effect.Def.Name)
+		w.DefeatPlayerInternal(t)
+		w.broadcastInternal(protocol.S2C_MessageTypePlayerStatUpdate, t.StatUpdatePayload())
+	case *Monster:
+		log.Printf("Monster %s succumbed to %s.", t.GetID(), effect.Def.Name)
+		if session := w.CombatSessionInternal(t); session != nil {
+			awards := w.AwardXPInternal(session)
+			w.EndCombatInternal(session, CombatEndMonsterDefeated)
+			for _, award := range awards {
+				w.broadcastInternal(protocol.S2C_MessageTypePlayerStatUpdate, award.Player.StatUpdatePayload())
+			}
+		}
+		w.DropLootInternal(t)
+		w.broadcastInternal(protocol.S2C_MessageTypeEntityRemoved, protocol.S2C_EntityRemovedPayload{
+			ID:         t.GetID(),
+			EntityType: protocol.EntityTypeMonster,
+		})
+		w.RemoveMonsterInternal(t.GetID())
+	}
+}
+
+func msDuration(ms int) time.Duration {
+	return time.Duration(ms) * time.Millisecond
+}
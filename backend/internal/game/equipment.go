@@ -0,0 +1,113 @@
+package game
+
+import (
+	"errors"
+	"log"
+	"maps"
+)
+
+// EquipmentSlots are the gear kinds a player can wear, one item of each, in the
+// order they are shown.
+var EquipmentSlots = []ItemKind{ItemWeapon, ItemArmour, ItemAccessory}
+
+// EquippedItem is an item worn in an equipment slot. Like an ActiveEffect it keeps
+// a copy of its definition, so a tuning reload doesn't change gear already worn.
+type EquippedItem struct {
+	Item ItemID
+	Def  ItemDef
+}
+
+// Equipment is what a player wears, keyed by slot. Empty slots are missing.
+type Equipment map[ItemKind]EquippedItem
+
+func (e Equipment) AttackMod() int {
+	mod := 0
+	for _, item := range e {
+		mod += item.Def.AttackMod
+	}
+	return mod
+}
+
+func (e Equipment) DefenseMod() int {
+	mod := 0
+	for _, item := range e {
+		mod += item.Def.DefenseMod
+	}
+	return mod
+}
+
+// withResistances adds the gear's resistances to base. It returns base itself when
+// no gear has any, so callers must not modify the result.
+func (e Equipment) withResistances(base Resistances) Resistances {
+	var total Resistances
+	for _, item := range e {
+		for d, v := range item.Def.Resistances {
+			if total == nil {
+				total = maps.Clone(base)
+				if total == nil {
+					total = Resistances{}
+				}
+			}
+			total[d] += v
+		}
+	}
+	if total == nil {
+		return base
+	}
+	return total
+}
+
+// Errors from EquipItemInternal and UnequipItemInternal. Their text is shown to players.
+var (
+	ErrNotEquippable   = errors.New("that item can't be equipped")
+	ErrNothingEquipped = errors.New("nothing is equipped there")
+	ErrInventoryFull   = errors.New("your inventory is full")
+)
+
+// EquipItemInternal wears one item from inventory slot, putting whatever was worn
+// in its place back in the inventory. It returns the inventory slots that changed.
+// Assumes w.Mu is HELD
+func (w *World) EquipItemInternal(p *Player, slot int) ([]int, error) {
+	stack, ok := p.Inventory.Get(slot)
+	if !ok {
+		return nil, ErrNoItem
+	}
+	def := w.Tuning.Items[stack.Item]
+	if !def.Kind.Equippable() {
+		return nil, ErrNotEquippable
+	}
+
+	p.Inventory.Remove(slot, 1)
+	changed := []int{slot}
+	if previous, ok := p.Equipment[def.Kind]; ok {
+		added, previousChanged := p.Inventory.Add(previous.Item, 1, previous.Def)
+		if added == 0 {
+			p.Inventory.Add(stack.Item, 1, def)
+			return nil, ErrInventoryFull
+		}
+		changed = append(changed, previousChanged...)
+	}
+	if p.Equipment == nil {
+		p.Equipment = Equipment{}
+	}
+	p.Equipment[def.Kind] = EquippedItem{Item: stack.Item, Def: def}
+	log.Printf("Player %s equipped %s as %s.", p.GetID(), def.Name, def.Kind)
+	return changed, nil
+}
+
+// UnequipItemInternal puts the item worn in gear slot kind back in the inventory
+// and returns the inventory slots that changed.
+// Assumes w.Mu is HELD
+func (w *World) UnequipItemInternal(p *Player, kind ItemKind) ([]int, error) {
+	item, ok := p.Equipment[kind]
+	if !ok {
+		return nil, ErrNothingEquipped
+	}
+	added, changed := p.Inventory.Add(item.Item, 1, item.Def)
+	if added == 0 {
+		return nil, ErrInventoryFull
+	}
+	delete(p.Equipment, kind)
+	log.Printf("Player %s unequipped %s.", p.GetID(), item.Def.Name)
+	return changed, nil
+}
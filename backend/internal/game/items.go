@@ -0,0 +1,231 @@
+package game
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+)
+
+type ItemID string
+
+type ItemKind string
+
+const (
+	ItemConsumable ItemKind = "consumable"
+	ItemMisc       ItemKind = "misc"
+	// Gear is worn in the equipment slot named after its kind.
+	ItemWeapon    ItemKind = "weapon"
+	ItemArmour    ItemKind = "armour"
+	ItemAccessory ItemKind = "accessory"
+)
+
+func (k ItemKind) Equippable() bool {
+	switch k {
+	case ItemWeapon, ItemArmour, ItemAccessory:
+		return true
+	}
+	return false
+}
+
+// ItemHealingPotion is the potion use_potion drinks and Config.PotionHealAmount
+// sets the strength of.
+const ItemHealingPotion ItemID = "healing_potion"
+
+// defaultItemsJSON is the built-in item table, keyed by item ID.
+//
+//go:embed items.json
+var defaultItemsJSON []byte
+
+// ItemDef describes a kind of item. Consumables are used up one at a time and do
+// everything they list: heal, apply Effect and remove the effects in Cures. Gear
+// adds its modifiers and resistances to the stats of whoever wears it.
+type ItemDef struct {
+	Name        string   `json:"name"`
+	Kind        ItemKind `json:"kind"`
+	Description string   `json:"description"`
+	// MaxStack is how many fit in one inventory slot; 0 counts as 1.
+	MaxStack int `json:"max_stack"`
+
+	Heal   int        `json:"heal"`
+	Effect EffectID   `json:"effect"`
+	Cures  []EffectID `json:"cures"`
+
+	AttackMod   int         `json:"attack_mod"`
+	DefenseMod  int         `json:"defense_mod"`
+	Resistances Resistances `json:"resistances"`
+	// DamageType is what a weapon's wielder deals, physical if empty.
+	DamageType DamageType `json:"damage_type"`
+}
+
+func (d ItemDef) stackSize() int {
+	return max(d.MaxStack, 1)
+}
+
+var defaultItems = func() map[ItemID]ItemDef {
+	var items map[ItemID]ItemDef
+	if err := json.Unmarshal(defaultItemsJSON, &items); err != nil {
+		panic(fmt.Sprintf("built-in items.json: %v", err))
+	}
+	return items
+}()
+
+func (d ItemDef) validate(effects map[EffectID]EffectDef) error {
+	if d.Name == "" {
+		return fmt.Errorf("name must not be empty")
+	}
+	switch d.Kind {
+	case ItemConsumable, ItemMisc, ItemWeapon, ItemArmour, ItemAccessory:
+	default:
+		return fmt.Errorf("unknown kind %q", d.Kind)
+	}
+	if d.MaxStack < 0 || d.Heal < 0 {
+		return fmt.Errorf("max_stack and heal must not be negative")
+	}
+	if err := d.Resistances.validate(); err != nil {
+		return err
+	}
+	if d.DamageType != "" && (d.Kind != ItemWeapon || !d.DamageType.Valid()) {
+		return fmt.Errorf("damage_type %q needs a weapon and a known damage type", d.DamageType)
+	}
+	for _, id := range append([]EffectID{d.Effect}, d.Cures...) {
+		if _, ok := effects[id]; id != "" && !ok {
+			return fmt.Errorf("unknown effect %q", id)
+		}
+	}
+	return nil
+}
+
+// ItemStack is the content of one inventory slot. An empty slot has Count 0.
+type ItemStack struct {
+	Item  ItemID `json:"item"`
+	Count int    `json:"count"`
+}
+
+// Inventory is a player's fixed number of item slots.
+type Inventory struct {
+	Slots []ItemStack
+}
+
+func NewInventory(capacity int) *Inventory {
+	return &Inventory{Slots: make([]ItemStack, capacity)}
+}
+
+// Add puts up to count of an item in the inventory, topping up existing stacks
+// before taking empty slots. It returns how many fit and the slots that changed.
+func (inv *Inventory) Add(id ItemID, count int, def ItemDef) (added int, changed []int) {
+	fill := func(i int) {
+		n := min(def.stackSize()-inv.Slots[i].Count, count-added)
+		if n <= 0 {
+			return
+		}
+		inv.Slots[i] = ItemStack{Item: id, Count: inv.Slots[i].Count + n}
+		added += n
+		changed = append(changed, i)
+	}
+	for i, slot := range inv.Slots {
+		if slot.Count > 0 && slot.Item == id {
+			fill(i)
+		}
+	}
+	for i, slot := range inv.Slots {
+		if slot.Count == 0 {
+			fill(i)
+		}
+	}
+	return added, changed
+}
+
+// Remove takes up to count items out of slot and returns what was taken.
+func (inv *Inventory) Remove(slot, count int) (ItemStack, bool) {
+	if slot < 0 || slot >= len(inv.Slots) || inv.Slots[slot].Count == 0 || count <= 0 {
+		return ItemStack{}, false
+	}
+	taken := ItemStack{Item: inv.Slots[slot].Item, Count: min(count, inv.Slots[slot].Count)}
+	inv.Slots[slot].Count -= taken.Count
+	if inv.Slots[slot].Count == 0 {
+		inv.Slots[slot] = ItemStack{}
+	}
+	return taken, true
+}
+
+// Find returns the first slot holding id, or -1.
+func (inv *Inventory) Find(id ItemID) int {
+	return slices.IndexFunc(inv.Slots, func(s ItemStack) bool { return s.Count > 0 && s.Item == id })
+}
+
+// Get returns the stack in slot, or false if the slot is empty or out of range.
+func (inv *Inventory) Get(slot int) (ItemStack, bool) {
+	if slot < 0 || slot >= len(inv.Slots) || inv.Slots[slot].Count == 0 {
+		return ItemStack{}, false
+	}
+	return inv.Slots[slot], true
+}
+
+// Errors from UseItemInternal and DropItemInternal. Their text is shown to players.
+var (
+	ErrNoItem      = errors.New("there is nothing in that slot")
+	ErrNotUsable   = errors.New("that item can't be used")
+	ErrNoUseEffect = errors.New("it would have no effect right now")
+)
+
+// ItemUse reports what using an item did.
+type ItemUse struct {
+	Item   ItemID
+	Def    ItemDef
+	Healed int
+	Cured  []EffectID
+	// Changed are the inventory slots that changed.
+	Changed []int
+}
+
+// UseItemInternal consumes one item from slot. It refuses, without using the item
+// up, when the item would do nothing at all.
+// Assumes w.Mu is HELD
+func (w *World) UseItemInternal(p *Player, slot int) (ItemUse, error) {
+	stack, ok := p.Inventory.Get(slot)
+	if !ok {
+		return ItemUse{}, ErrNoItem
+	}
+	def := w.Tuning.Items[stack.Item]
+	if def.Kind != ItemConsumable {
+		return ItemUse{}, ErrNotUsable
+	}
+
+	var cures []*ActiveEffect
+	for _, id := range def.Cures {
+		if effect := p.Effects.find(id); effect != nil {
+			cures = append(cures, effect)
+		}
+	}
+	if def.Effect == "" && len(cures) == 0 && (def.Heal == 0 || p.CurrentHP >= p.MaxHP) {
+		return ItemUse{}, ErrNoUseEffect
+	}
+
+	use := ItemUse{Item: stack.Item, Def: def, Changed: []int{slot}}
+	p.Inventory.Remove(slot, 1)
+	use.Healed = p.Heal(def.Heal)
+	for _, effect := range cures {
+		w.expireEffectInternal(p, effect)
+		use.Cured = append(use.Cured, effect.ID)
+	}
+	if def.Effect != "" {
+		w.ApplyEffectInternal(p, def.Effect, p.GetID())
+	}
+	log.Printf("Player %s used %s from slot %d.", p.GetID(), def.Name, slot)
+	return use, nil
+}
+
+// DropItemInternal puts up to count items from slot on the ground where p stands.
+// Assumes w.Mu is HELD
+func (w *World) DropItemInternal(p *Player, slot, count int) (ItemStack, error) {
+	dropped, ok := p.Inventory.Remove(slot, count)
+	if !ok {
+		return ItemStack{}, ErrNoItem
+	}
+	log.Printf("Player %s dropped %d x %s at (%d,%d).", p.GetID(), dropped.Count, dropped.Item, p.X, p.Y)
+	w.PlaceItemInternal(p.X, p.Y, dropped)
+	return dropped, nil
+}
@@ -0,0 +1,108 @@
+package game
+
+import (
+	"container/heap"
+	"log"
+	"slices"
+	"strings"
+	"time"
+)
+
+// DefaultTickRate is how many times per second the simulation advances.
+const DefaultTickRate = 10
+
+// timer is a function queued with ScheduleInternal. seq keeps timers due on the same
+// tick in the order they were scheduled.
+type timer struct {
+	due uint64
+	seq uint64
+	fn  func()
+}
+
+type timerQueue []timer
+
+func (q timerQueue) Len() int { return len(q) }
+func (q timerQueue) Less(i, j int) bool {
+	if q[i].due != q[j].due {
+		return q[i].due < q[j].due
+	}
+	return q[i].seq < q[j].seq
+}
+func (q timerQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+func (q *timerQueue) Push(x any)   { *q = append(*q, x.(timer)) }
+func (q *timerQueue) Pop() any {
+	old := *q
+	t := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return t
+}
+
+// Step advances the world by one tick: timers that are due fire first, then status
+// effects tick, then every monster whose turn it is acts, in ID order. Run calls it at TickRate; tests can
+// call it directly to drive the simulation by hand.
+func (w *World) Step() {
+	w.Mu.Lock()
+	defer w.Mu.Unlock()
+
+	w.Tick++
+	for len(w.timers) > 0 && w.timers[0].due <= w.Tick {
+		t := heap.Pop(&w.timers).(timer)
+		t.fn()
+	}
+	w.tickEffectsInternal()
+
+	// Timers and AI may add or remove monsters, so walk a snapshot.
+	for _, m := range slices.Clone(w.monsterOrder) {
+		if w.Monsters[m.ID] == m {
+			m.stepAI(w)
+		}
+	}
+}
+
+// ScheduleInternal runs fn after the given number of ticks, with w.Mu held, during
+// Step. A delay below one tick runs it on the next tick.
+// Assumes w.Mu is HELD
+func (w *World) ScheduleInternal(ticks uint64, fn func()) {
+	w.timerSeq++
+	heap.Push(&w.timers, timer{due: w.Tick + max(ticks, 1), seq: w.timerSeq, fn: fn})
+}
+
+// TicksFor converts a duration to a whole number of ticks at the world's tick rate,
+// never less than one.
+func (w *World) TicksFor(d time.Duration) uint64 {
+	ticks := uint64(d * time.Duration(w.TickRate) / time.Second)
+	return max(ticks, 1)
+}
+
+// Run calls Step TickRate times a second until stop is closed.
+func (w *World) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(time.Second / time.Duration(w.TickRate))
+	defer ticker.Stop()
+
+	log.Printf("Floor %d simulation running at %d ticks per second.", w.Depth, w.TickRate)
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			w.Step()
+		}
+	}
+}
+
+// addToMonsterOrder keeps monsterOrder sorted by ID so monsters act in the same order
+// every tick.
+// Assumes w.Mu is HELD
+func (w *World) addToMonsterOrder(m *Monster) {
+	i, _ := slices.BinarySearchFunc(w.monsterOrder, m.ID, func(e *Monster, id string) int {
+		return strings.Compare(e.ID, id)
+	})
+	w.monsterOrder = slices.Insert(w.monsterOrder, i, m)
+}
+
+// Assumes w.Mu is HELD
+func (w *World) removeFromMonsterOrder(m *Monster) {
+	if i := slices.Index(w.monsterOrder, m); i >= 0 {
+		w.monsterOrder = slices.Delete(w.monsterOrder, i, i+1)
+	}
+}
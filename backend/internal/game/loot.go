@@ -0,0 +1,171 @@
+package game
+
+import (
+	"fmt"
+	"game-server/internal/protocol"
+	"log"
+	"maps"
+	"math/rand"
+	"slices"
+)
+
+// LootEntry is one line of a monster's loot table. An entry without an Item is the
+// chance of dropping nothing.
+type LootEntry struct {
+	Item   ItemID `json:"item"`
+	Weight int    `json:"weight"`
+	// Min and Max bound how many drop; 0 counts as 1.
+	Min int `json:"min"`
+	Max int `json:"max"`
+}
+
+// LootTable is rolled once when a monster dies, picking an entry by weight.
+type LootTable []LootEntry
+
+func (t LootTable) roll(rng *rand.Rand) (ItemStack, bool) {
+	total := 0
+	for _, entry := range t {
+		total += entry.Weight
+	}
+	if total == 0 {
+		return ItemStack{}, false
+	}
+	n := rng.Intn(total)
+	for _, entry := range t {
+		if n -= entry.Weight; n < 0 {
+			if entry.Item == "" {
+				return ItemStack{}, false
+			}
+			lo, hi := max(entry.Min, 1), max(entry.Max, entry.Min, 1)
+			return ItemStack{Item: entry.Item, Count: lo + rng.Intn(hi-lo+1)}, true
+		}
+	}
+	return ItemStack{}, false
+}
+
+func (t LootTable) validate(items map[ItemID]ItemDef) error {
+	for _, entry := range t {
+		if _, ok := items[entry.Item]; entry.Item != "" && !ok {
+			return fmt.Errorf("unknown loot item %q", entry.Item)
+		}
+		if entry.Weight < 0 || entry.Min < 0 || entry.Max < 0 {
+			return fmt.Errorf("loot weight, min and max must not be negative")
+		}
+		if entry.Max != 0 && entry.Max < entry.Min {
+			return fmt.Errorf("loot max for %q must be at least min", entry.Item)
+		}
+	}
+	return nil
+}
+
+// GroundItem is a stack of items lying on a tile of the floor.
+type GroundItem struct {
+	ID    string
+	X, Y  int
+	Stack ItemStack
+	seq   int
+}
+
+// GroundItemsInternal returns the items on the floor, oldest first.
+// Assumes w.Mu is HELD
+func (w *World) GroundItemsInternal() []*GroundItem {
+	items := slices.Collect(maps.Values(w.groundItems))
+	slices.SortFunc(items, func(a, b *GroundItem) int { return a.seq - b.seq })
+	return items
+}
+
+// GroundItemData describes item for clients.
+// Assumes w.Mu is HELD
+func (w *World) GroundItemData(item *GroundItem) protocol.S2C_GroundItemData {
+	def := w.Tuning.Items[item.Stack.Item]
+	return protocol.S2C_GroundItemData{
+		ID:     item.ID,
+		X:      item.X,
+		Y:      item.Y,
+		ItemID: string(item.Stack.Item),
+		Name:   def.Name,
+		Kind:   string(def.Kind),
+		Count:  item.Stack.Count,
+	}
+}
+
+// PlaceItemInternal puts stack on the ground at (x, y), tells the floor and
+// schedules it to despawn after Tuning.LootDespawnMs unless someone takes it.
+// Assumes w.Mu is HELD
+func (w *World) PlaceItemInternal(x, y int, stack ItemStack) *GroundItem {
+	item := &GroundItem{
+		ID:    fmt.Sprintf("item-%d-%03d", w.Depth, w.groundItemSeq),
+		X:     x,
+		Y:     y,
+		Stack: stack,
+		seq:   w.groundItemSeq,
+	}
+	w.groundItemSeq++
+	w.groundItems[item.ID] = item
+	w.broadcastInternal(protocol.S2C_MessageTypeGroundItemAdded, w.GroundItemData(item))
+
+	w.ScheduleInternal(w.TicksFor(msDuration(w.Tuning.LootDespawnMs)), func() {
+		if w.groundItems[item.ID] == item {
+			log.Printf("%d x %s despawned at (%d,%d) on floor %d.", item.Stack.Count, item.Stack.Item, item.X, item.Y, w.Depth)
+			w.removeGroundItemInternal(item)
+		}
+	})
+	return item
+}
+
+// Assumes w.Mu is HELD
+func (w *World) removeGroundItemInternal(item *GroundItem) {
+	delete(w.groundItems, item.ID)
+	w.broadcastInternal(protocol.S2C_MessageTypeGroundItemRemoved, protocol.S2C_GroundItemRemovedPayload{ID: item.ID})
+}
+
+// DropLootInternal rolls the loot table of m's archetype and drops the result where
+// m stands. It returns nil when nothing dropped.
+// Assumes w.Mu is HELD
+func (w *World) DropLootInternal(m *Monster) *GroundItem {
+	stack, ok := w.Tuning.Monsters[m.Type].Loot.roll(w.rng)
+	if !ok {
+		return nil
+	}
+	log.Printf("Monster %s dropped %d x %s at (%d,%d).", m.GetID(), stack.Count, stack.Item, m.X, m.Y)
+	return w.PlaceItemInternal(m.X, m.Y, stack)
+}
+
+// Pickup reports what PickUpInternal took.
+type Pickup struct {
+	Items []ItemStack
+	// Changed are the inventory slots that changed.
+	Changed []int
+	// Full is set when something was left behind for lack of room.
+	Full bool
+}
+
+// PickUpInternal moves the items on p's tile into p's inventory, as many as fit.
+// What doesn't fit stays on the ground.
+// Assumes w.Mu is HELD
+func (w *World) PickUpInternal(p *Player) Pickup {
+	var pickup Pickup
+	for _, item := range w.GroundItemsInternal() {
+		if item.X != p.X || item.Y != p.Y {
+			continue
+		}
+		added, changed := p.Inventory.Add(item.Stack.Item, item.Stack.Count, w.Tuning.Items[item.Stack.Item])
+		if added > 0 {
+			pickup.Items = append(pickup.Items, ItemStack{Item: item.Stack.Item, Count: added})
+			pickup.Changed = append(pickup.Changed, changed...)
+			log.Printf("Player %s picked up %d x %s.", p.GetID(), added, item.Stack.Item)
+		}
+		if added < item.Stack.Count {
+			pickup.Full = true
+			if added > 0 {
+				item.Stack.Count -= added
+				w.broadcastInternal(protocol.S2C_MessageTypeGroundItemAdded, w.GroundItemData(item))
+			}
+			continue
+		}
+		w.removeGroundItemInternal(item)
+	}
+	slices.Sort(pickup.Changed)
+	pickup.Changed = slices.Compact(pickup.Changed)
+	return pickup
+}
@@ -0,0 +1,230 @@
+package game
+
+import (
+	"fmt"
+	"game-server/internal/protocol"
+	"math/rand"
+)
+
+// MapGenerator fills a width x height grid of tiles. Generators must only draw
+// randomness from rng so a world seed always produces the same map.
+type MapGenerator interface {
+	Generate(width, height int, rng *rand.Rand) [][]Tile
+}
+
+// NewMapGenerator returns the generator registered under name, using its default settings.
+func NewMapGenerator(name string) (MapGenerator, error) {
+	switch name {
+	case "", "scatter":
+		return ScatterGenerator{StonePercent: 20}, nil
+	case "bsp":
+		return BSPGenerator{MinLeafSize: 6, MinRoomSize: 3, MaxDepth: 5}, nil
+	case "cave":
+		return CaveGenerator{FillPercent: 45, Iterations: 5}, nil
+	default:
+		return nil, fmt.Errorf("unknown map generator %q (want scatter, bsp or cave)", name)
+	}
+}
+
+func newTileGrid(width, height int, fill protocol.TileType) [][]Tile {
+	tiles := make([][]Tile, height)
+	for y := 0; y < height; y++ {
+		tiles[y] = make([]Tile, width)
+		for x := 0; x < width; x++ {
+			tiles[y][x] = Tile{Type: fill, X: x, Y: y}
+		}
+	}
+	return tiles
+}
+
+func isBorder(x, y, width, height int) bool {
+	return x == 0 || y == 0 || x == width-1 || y == height-1
+}
+
+// ScatterGenerator turns a random StonePercent of tiles into stone inside a stone border.
+type ScatterGenerator struct {
+	StonePercent int
+}
+
+func (g ScatterGenerator) Generate(width, height int, rng *rand.Rand) [][]Tile {
+	tiles := newTileGrid(width, height, protocol.Grass)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if rng.Intn(100) < g.StonePercent || isBorder(x, y, width, height) {
+				tiles[y][x].Type = protocol.Stone
+			}
+		}
+	}
+	return tiles
+}
+
+// BSPGenerator splits the map into a binary tree of areas, carves a room into every
+// leaf and joins sibling subtrees with L-shaped corridors.
+type BSPGenerator struct {
+	MinLeafSize int // areas smaller than twice this are not split further
+	MinRoomSize int
+	MaxDepth    int
+}
+
+type rect struct {
+	X, Y, W, H int
+}
+
+func (g BSPGenerator) Generate(width, height int, rng *rand.Rand) [][]Tile {
+	tiles := newTileGrid(width, height, protocol.Stone)
+	g.split(tiles, rect{X: 1, Y: 1, W: width - 2, H: height - 2}, 0, rng)
+	return tiles
+}
+
+// split carves the rooms for area r and returns a point inside one of them, which
+// the parent uses as a corridor endpoint.
+func (g BSPGenerator) split(tiles [][]Tile, r rect, depth int, rng *rand.Rand) (int, int) {
+	canSplitV := r.W >= 2*g.MinLeafSize
+	canSplitH := r.H >= 2*g.MinLeafSize
+	if depth >= g.MaxDepth || (!canSplitV && !canSplitH) {
+		return g.carveRoom(tiles, r, rng)
+	}
+
+	vertical := canSplitV
+	if canSplitV && canSplitH {
+		switch {
+		case r.W > r.H:
+			vertical = true
+		case r.H > r.W:
+			vertical = false
+		default:
+			vertical = rng.Intn(2) == 0
+		}
+	}
+
+	var a, b rect
+	if vertical {
+		cut := g.MinLeafSize + rng.Intn(r.W-2*g.MinLeafSize+1)
+		a = rect{X: r.X, Y: r.Y, W: cut, H: r.H}
+		b = rect{X: r.X + cut, Y: r.Y, W: r.W - cut, H: r.H}
+	} else {
+		cut := g.MinLeafSize + rng.Intn(r.H-2*g.MinLeafSize+1)
+		a = rect{X: r.X, Y: r.Y, W: r.W, H: cut}
+		b = rect{X: r.X, Y: r.Y + cut, W: r.W, H: r.H - cut}
+	}
+
+	ax, ay := g.split(tiles, a, depth+1, rng)
+	bx, by := g.split(tiles, b, depth+1, rng)
+	carveCorridor(tiles, ax, ay, bx, by, rng)
+
+	if rng.Intn(2) == 0 {
+		return ax, ay
+	}
+	return bx, by
+}
+
+func (g BSPGenerator) carveRoom(tiles [][]Tile, r rect, rng *rand.Rand) (int, int) {
+	if r.W <= 0 || r.H <= 0 {
+		return r.X, r.Y
+	}
+	// Leave a one tile wall inside the area when there is room for it, so rooms in
+	// neighbouring leaves don't merge.
+	margin := 0
+	if r.W >= 3 && r.H >= 3 {
+		margin = 1
+	}
+	roomW := roomSize(r.W-2*margin, g.MinRoomSize, rng)
+	roomH := roomSize(r.H-2*margin, g.MinRoomSize, rng)
+	roomX := r.X + margin + rng.Intn(r.W-2*margin-roomW+1)
+	roomY := r.Y + margin + rng.Intn(r.H-2*margin-roomH+1)
+
+	for y := roomY; y < roomY+roomH; y++ {
+		for x := roomX; x < roomX+roomW; x++ {
+			tiles[y][x].Type = protocol.Grass
+		}
+	}
+	return roomX + roomW/2, roomY + roomH/2
+}
+
+func roomSize(available, min int, rng *rand.Rand) int {
+	if available <= min {
+		return available
+	}
+	return min + rng.Intn(available-min+1)
+}
+
+func carveCorridor(tiles [][]Tile, x1, y1, x2, y2 int, rng *rand.Rand) {
+	if rng.Intn(2) == 0 {
+		carveHorizontal(tiles, x1, x2, y1)
+		carveVertical(tiles, y1, y2, x2)
+	} else {
+		carveVertical(tiles, y1, y2, x1)
+		carveHorizontal(tiles, x1, x2, y2)
+	}
+}
+
+func carveHorizontal(tiles [][]Tile, x1, x2, y int) {
+	if x1 > x2 {
+		x1, x2 = x2, x1
+	}
+	for x := x1; x <= x2; x++ {
+		tiles[y][x].Type = protocol.Grass
+	}
+}
+
+func carveVertical(tiles [][]Tile, y1, y2, x int) {
+	if y1 > y2 {
+		y1, y2 = y2, y1
+	}
+	for y := y1; y <= y2; y++ {
+		tiles[y][x].Type = protocol.Grass
+	}
+}
+
+// CaveGenerator seeds the map with FillPercent stone and smooths it with a cellular
+// automaton: a tile becomes stone when at least 5 of the 9 tiles around it (itself
+// included) are stone.
+type CaveGenerator struct {
+	FillPercent int
+	Iterations  int
+}
+
+func (g CaveGenerator) Generate(width, height int, rng *rand.Rand) [][]Tile {
+	wall := make([][]bool, height)
+	for y := 0; y < height; y++ {
+		wall[y] = make([]bool, width)
+		for x := 0; x < width; x++ {
+			wall[y][x] = isBorder(x, y, width, height) || rng.Intn(100) < g.FillPercent
+		}
+	}
+
+	for i := 0; i < g.Iterations; i++ {
+		next := make([][]bool, height)
+		for y := 0; y < height; y++ {
+			next[y] = make([]bool, width)
+			for x := 0; x < width; x++ {
+				next[y][x] = isBorder(x, y, width, height) || countWalls(wall, x, y) >= 5
+			}
+		}
+		wall = next
+	}
+
+	tiles := newTileGrid(width, height, protocol.Grass)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if wall[y][x] {
+				tiles[y][x].Type = protocol.Stone
+			}
+		}
+	}
+	return tiles
+}
+
+// countWalls counts stone in the 3x3 block around (x, y). Out of bounds counts as stone.
+func countWalls(wall [][]bool, x, y int) int {
+	count := 0
+	for dy := -1; dy <= 1; dy++ {
+		for dx := -1; dx <= 1; dx++ {
+			nx, ny := x+dx, y+dy
+			if ny < 0 || ny >= len(wall) || nx < 0 || nx >= len(wall[ny]) || wall[ny][nx] {
+				count++
+			}
+		}
+	}
+	return count
+}
@@ -3,8 +3,7 @@ package game
 import (
 	"game-server/internal/protocol"
 	"log"
-	"math/rand"
-	"time"
+	"unicode/utf8"
 )
 
 type Monster struct {
@@ -14,54 +13,90 @@ type Monster struct {
 	// stats
 	Type      protocol.MonsterType
 	Name      string
+	Glyph     string
 	MaxHP     int
 	CurrentHP int
 	Attack    int
 	Defense   int
 	XPValue   int
 
-	// Combat State
+	Behaviour      MonsterBehaviour
+	AggroRadius    int
+	GiveUpDistance int
+	OnHit          []OnHitEffect
+	DamageType     DamageType
+	Resistances    Resistances
+
+	Effects Effects
+
+	// Combat State. CombatTargetID is the attacker the monster hits back, the top
+	// of its session's threat table.
 	IsInCombat     bool
 	CombatTargetID string
 
-	stopAI chan struct{}
+	// AI schedule in world ticks, set when the monster is added to a World.
+	nextActTick uint64
+	actEvery    uint64
+	// leftAlone holds players the monster won't hunt until the given tick.
+	leftAlone map[string]uint64
+	// chaseTargetID is the player being hunted, if any.
+	chaseTargetID string
+	// slot is the population slot the monster fills, nil if it isn't respawned.
+	slot *spawnSlot
 }
 
-func NewMonster(id string, mType protocol.MonsterType, x, y int) *Monster {
-	monster := &Monster{
+func NewMonster(id string, mType protocol.MonsterType, stats MonsterStats, x, y int) *Monster {
+	return &Monster{
 		ID:             id,
 		Type:           mType,
 		X:              x,
 		Y:              y,
+		Name:           stats.Name,
+		Glyph:          stats.Glyph,
+		Behaviour:      stats.Behaviour,
+		MaxHP:          stats.MaxHP,
+		CurrentHP:      stats.MaxHP,
+		Attack:         stats.Attack,
+		Defense:        stats.Defense,
+		XPValue:        stats.XPValue,
+		AggroRadius:    stats.AggroRadius,
+		GiveUpDistance: stats.GiveUpDistance,
+		OnHit:          stats.OnHit,
+		DamageType:     stats.DamageType,
+		Resistances:    stats.Resistances,
 		IsInCombat:     false,
 		CombatTargetID: "",
-		stopAI:         make(chan struct{}),
-	}
-
-	switch mType {
-	case protocol.Goblin:
-		monster.Name = "Goblin"
-		monster.MaxHP = 30
-		monster.CurrentHP = 30
-		monster.Attack = 8
-		monster.Defense = 3
-		monster.XPValue = 10
-	case protocol.Orc:
-		monster.Name = "Orc"
-		monster.MaxHP = 70
-		monster.CurrentHP = 70
-		monster.Attack = 15
-		monster.Defense = 8
-		monster.XPValue = 25
-	default:
-		monster.Name = "Mysterious Creature"
-		monster.MaxHP = 50
-		monster.CurrentHP = 50
-		monster.Attack = 10
-		monster.Defense = 5
-		monster.XPValue = 15
-	}
-	return monster
+	}
+}
+
+// applyStats swaps in a new stat block, keeping the monster's HP at the same fraction
+// of its maximum.
+func (m *Monster) applyStats(stats MonsterStats) {
+	hpFraction := float64(m.CurrentHP) / float64(m.MaxHP)
+	m.Name = stats.Name
+	m.Glyph = stats.Glyph
+	m.Behaviour = stats.Behaviour
+	m.MaxHP = stats.MaxHP
+	m.Attack = stats.Attack
+	m.Defense = stats.Defense
+	m.XPValue = stats.XPValue
+	m.AggroRadius = stats.AggroRadius
+	m.GiveUpDistance = stats.GiveUpDistance
+	m.OnHit = stats.OnHit
+	m.DamageType = stats.DamageType
+	m.Resistances = stats.Resistances
+	m.CurrentHP = int(hpFraction * float64(stats.MaxHP))
+	if m.CurrentHP < 1 {
+		m.CurrentHP = 1
+	}
+}
+
+// GlyphRune is the character that stands for the monster on text maps.
+func (m *Monster) GlyphRune() rune {
+	if r, _ := utf8.DecodeRuneInString(m.Glyph); r != utf8.RuneError {
+		return r
+	}
+	return 'M'
 }
 
 func (m *Monster) GetID() string {
@@ -85,42 +120,145 @@ func (m *Monster) TakeDamage(amount int) bool {
 	return false
 }
 
-func (m *Monster) RunAI(w *World) {
-	initialDelay := time.Duration(rand.Intn(750)+250) * time.Millisecond // 0.25s to 1s
-	time.Sleep(initialDelay)
+func (m *Monster) Heal(amount int) int {
+	healed := max(min(amount, m.MaxHP-m.CurrentHP), 0)
+	m.CurrentHP += healed
+	return healed
+}
+
+// EffectiveAttack and EffectiveDefense include the monster's status effects.
+func (m *Monster) EffectiveAttack() int {
+	return max(m.Attack+m.Effects.AttackMod(), 0)
+}
 
-	ticker := time.NewTicker(time.Duration(rand.Intn(750)+250) * time.Millisecond) // Random tick between 0.25s and 1s
-	defer ticker.Stop()
+func (m *Monster) EffectiveDefense() int {
+	return max(m.Defense+m.Effects.DefenseMod(), 0)
+}
 
-	for {
-		select {
-		case <-m.stopAI:
+func (m *Monster) AttackDamageType() DamageType {
+	if m.DamageType == "" {
+		return DamagePhysical
+	}
+	return m.DamageType
+}
+
+func (m *Monster) DamageResistances() Resistances { return m.Resistances }
+
+func (m *Monster) effectList() *Effects { return &m.Effects }
+func (m *Monster) entityType() string   { return protocol.EntityTypeMonster }
+func (m *Monster) currentHP() int       { return m.CurrentHP }
+
+// stepAI is called by World.Step every tick and acts when it is the monster's turn.
+// Assumes w.Mu is HELD
+func (m *Monster) stepAI(w *World) {
+	if w.Tick < m.nextActTick {
+		return
+	}
+	m.nextActTick = w.Tick + m.actEvery
+
+	if m.IsInCombat {
+		log.Printf("Monster %s (%s) is in combat with %s, not moving.", m.ID, m.Name, m.CombatTargetID)
+		return
+	}
+	if m.Effects.Stunned() {
+		return
+	}
+
+	if m.Behaviour != BehaviourWander {
+		if target := m.pickChaseTarget(w); target != nil {
+			m.chase(w, target)
 			return
-		case <-ticker.C:
-			w.Mu.Lock()
-
-			if m.IsInCombat {
-				log.Printf("Monster %s (%s) is in combat with %s, not moving.", m.ID, m.Name, m.CombatTargetID)
-			} else {
-				dx, dy := 0, 0
-				r := rand.Intn(4)
-				switch r {
-				case 0: // Up
-					dy = -1
-				case 1: // Down
-					dy = 1
-				case 2: // Left
-					dx = -1
-				case 3: // Right
-					dx = 1
-				}
-
-				currentX, currentY := m.X, m.Y
-				newX, newY := currentX+dx, currentY+dy
-
-				w.MoveMonster(m, newX, newY)
-			}
-			w.Mu.Unlock()
 		}
 	}
+	if m.Behaviour == BehaviourGuard {
+		return
+	}
+
+	dx, dy := 0, 0
+	r := w.rng.Intn(4)
+	switch r {
+	case 0: // Up
+		dy = -1
+	case 1: // Down
+		dy = 1
+	case 2: // Left
+		dx = -1
+	case 3: // Right
+		dx = 1
+	}
+
+	currentX, currentY := m.X, m.Y
+	newX, newY := currentX+dx, currentY+dy
+
+	w.MoveMonster(m, newX, newY)
+}
+
+// pickChaseTarget keeps hunting the current target until it gets further than
+// GiveUpDistance away, otherwise picks the closest free player within AggroRadius.
+// Assumes w.Mu is HELD
+func (m *Monster) pickChaseTarget(w *World) *Player {
+	here := Point{X: m.X, Y: m.Y}
+	if m.chaseTargetID != "" {
+		p, ok := w.Players[m.chaseTargetID]
+		if ok && !p.IsInCombat && manhattan(here, Point{X: p.X, Y: p.Y}) <= m.GiveUpDistance {
+			return p
+		}
+		log.Printf("Monster %s (%s) gave up chasing %s.", m.ID, m.Name, m.chaseTargetID)
+		m.chaseTargetID = ""
+	}
+
+	var best *Player
+	bestDist := 0
+	for _, p := range w.Players {
+		if p.IsInCombat || w.Tick < m.leftAlone[p.ID] {
+			continue
+		}
+		dist := manhattan(here, Point{X: p.X, Y: p.Y})
+		if dist > m.AggroRadius {
+			continue
+		}
+		if best == nil || dist < bestDist || (dist == bestDist && p.ID < best.ID) {
+			best, bestDist = p, dist
+		}
+	}
+	if best != nil {
+		log.Printf("Monster %s (%s) noticed %s and gives chase.", m.ID, m.Name, best.ID)
+		m.chaseTargetID = best.ID
+	}
+	return best
+}
+
+// leaveAlone stops the monster hunting p until tick until. now is the current tick,
+// used to forget players whose time is already up.
+func (m *Monster) leaveAlone(p *Player, now, until uint64) {
+	if m.leftAlone == nil {
+		m.leftAlone = make(map[string]uint64)
+	}
+	for id, tick := range m.leftAlone {
+		if tick <= now {
+			delete(m.leftAlone, id)
+		}
+	}
+	m.leftAlone[p.ID] = until
+	if m.chaseTargetID == p.ID {
+		m.chaseTargetID = ""
+	}
+}
+
+// chase takes one step along a path towards p and attacks once next to it.
+// Assumes w.Mu is HELD
+func (m *Monster) chase(w *World, p *Player) {
+	target := Point{X: p.X, Y: p.Y}
+	if manhattan(Point{X: m.X, Y: m.Y}, target) > 1 {
+		reach := 2*m.GiveUpDistance + 1
+		path, ok := w.FindPathInternal(Point{X: m.X, Y: m.Y}, target, PathOptions{AvoidHazards: true, MaxNodes: reach * reach})
+		if !ok || len(path) < 2 {
+			return // blocked for now; try again next turn
+		}
+		w.MoveMonster(m, path[0].X, path[0].Y)
+	}
+	if manhattan(Point{X: m.X, Y: m.Y}, target) == 1 {
+		m.chaseTargetID = ""
+		w.StartCombatInternal(p, m)
+	}
 }
@@ -0,0 +1,78 @@
+package game
+
+// occupancy indexes monsters and players by tile so that position lookups don't
+// scan every entity. A tile holds at most one monster and one player. Like the rest
+// of World it is only touched with w.Mu held.
+type occupancy struct {
+	width, height int
+	monsters      []*Monster
+	players       []*Player
+}
+
+func newOccupancy(width, height int) occupancy {
+	return occupancy{
+		width:    width,
+		height:   height,
+		monsters: make([]*Monster, width*height),
+		players:  make([]*Player, width*height),
+	}
+}
+
+func (o *occupancy) index(x, y int) (int, bool) {
+	if x < 0 || x >= o.width || y < 0 || y >= o.height {
+		return 0, false
+	}
+	return y*o.width + x, true
+}
+
+func (o *occupancy) monsterAt(x, y int) *Monster {
+	if i, ok := o.index(x, y); ok {
+		return o.monsters[i]
+	}
+	return nil
+}
+
+func (o *occupancy) playerAt(x, y int) *Player {
+	if i, ok := o.index(x, y); ok {
+		return o.players[i]
+	}
+	return nil
+}
+
+func (o *occupancy) addMonster(m *Monster) {
+	if i, ok := o.index(m.X, m.Y); ok {
+		o.monsters[i] = m
+	}
+}
+
+// removeMonster clears m's tile, leaving it alone if something else has since been
+// indexed there.
+func (o *occupancy) removeMonster(m *Monster) {
+	if i, ok := o.index(m.X, m.Y); ok && o.monsters[i] == m {
+		o.monsters[i] = nil
+	}
+}
+
+func (o *occupancy) moveMonster(m *Monster, x, y int) {
+	o.removeMonster(m)
+	m.X, m.Y = x, y
+	o.addMonster(m)
+}
+
+func (o *occupancy) addPlayer(p *Player) {
+	if i, ok := o.index(p.X, p.Y); ok {
+		o.players[i] = p
+	}
+}
+
+func (o *occupancy) removePlayer(p *Player) {
+	if i, ok := o.index(p.X, p.Y); ok && o.players[i] == p {
+		o.players[i] = nil
+	}
+}
+
+func (o *occupancy) movePlayer(p *Player, x, y int) {
+	o.removePlayer(p)
+	p.X, p.Y = x, y
+	o.addPlayer(p)
+}
@@ -0,0 +1,212 @@
+package game
+
+import (
+	"fmt"
+	"game-server/internal/protocol"
+	"math/rand"
+	"testing"
+)
+
+// checkOccupancy fails t unless the occupancy grid holds exactly the entities in
+// w.Monsters and w.Players, each at its current position.
+func checkOccupancy(t *testing.T, w *World) {
+	t.Helper()
+	for id, m := range w.Monsters {
+		if got := w.getMonsterAtInternal(m.X, m.Y); got != m {
+			t.Fatalf("monster %s at (%d,%d) is indexed as %v", id, m.X, m.Y, got)
+		}
+	}
+	for id, p := range w.Players {
+		if got := w.getPlayerAtInternal(p.X, p.Y); got != p {
+			t.Fatalf("player %s at (%d,%d) is indexed as %v", id, p.X, p.Y, got)
+		}
+	}
+
+	monsters, players := 0, 0
+	for y := 0; y < w.Height; y++ {
+		for x := 0; x < w.Width; x++ {
+			if m := w.getMonsterAtInternal(x, y); m != nil {
+				monsters++
+				if w.Monsters[m.ID] != m || m.X != x || m.Y != y {
+					t.Fatalf("stale monster %s indexed at (%d,%d), it is at (%d,%d)", m.ID, x, y, m.X, m.Y)
+				}
+			}
+			if p := w.getPlayerAtInternal(x, y); p != nil {
+				players++
+				if w.Players[p.ID] != p || p.X != x || p.Y != y {
+					t.Fatalf("stale player %s indexed at (%d,%d), it is at (%d,%d)", p.ID, x, y, p.X, p.Y)
+				}
+			}
+		}
+	}
+	if monsters != len(w.Monsters) || players != len(w.Players) {
+		t.Fatalf("grid holds %d monsters and %d players, world has %d and %d", monsters, players, len(w.Monsters), len(w.Players))
+	}
+}
+
+// populate adds monsters and players on free reachable tiles of w, with IDs
+// starting with prefix.
+func populate(tb testing.TB, w *World, prefix string, monsters, players int) {
+	tb.Helper()
+	for i := 0; i < monsters; i++ {
+		w.Mu.Lock()
+		x, y, ok := w.findFreeReachableTile()
+		w.Mu.Unlock()
+		if !ok {
+			tb.Fatalf("no free tile for monster %d", i)
+		}
+		w.AddMonster(NewMonster(fmt.Sprintf("%sm%d", prefix, i), protocol.Goblin, w.Tuning.Monsters[protocol.Goblin], x, y))
+	}
+	w.Mu.Lock()
+	defer w.Mu.Unlock()
+	for i := 0; i < players; i++ {
+		x, y, ok := w.findFreeReachableTile()
+		if !ok {
+			tb.Fatalf("no free tile for player %d", i)
+		}
+		w.AddPlayer(NewPlayer(fmt.Sprintf("%sp%d", prefix, i), x, y, w.Tuning))
+	}
+}
+
+var steps = []Point{{X: 0, Y: -1}, {X: 0, Y: 1}, {X: -1, Y: 0}, {X: 1, Y: 0}}
+
+func TestOccupancyTracksEntities(t *testing.T) {
+	gen, _ := NewMapGenerator("cave")
+	w := NewWorld(64, 64, 7, gen)
+	populate(t, w, "", 200, 50)
+
+	w.Mu.Lock()
+	checkOccupancy(t, w)
+	rng := rand.New(rand.NewSource(1))
+	for round := 0; round < 20; round++ {
+		for _, m := range w.Monsters {
+			step := steps[rng.Intn(len(steps))]
+			w.MoveMonster(m, m.X+step.X, m.Y+step.Y)
+		}
+		for _, p := range w.Players {
+			step := steps[rng.Intn(len(steps))]
+			p.Move(step.X, step.Y, w)
+		}
+		checkOccupancy(t, w)
+	}
+
+	// A move onto an occupied tile is refused and leaves both entities indexed.
+	var a, b *Monster
+	for _, m := range w.Monsters {
+		if a == nil {
+			a = m
+		} else if b == nil {
+			b = m
+		}
+	}
+	ax, ay := a.X, a.Y
+	if w.MoveMonster(a, b.X, b.Y) {
+		t.Fatalf("monster %s moved onto %s", a.ID, b.ID)
+	}
+	if a.X != ax || a.Y != ay {
+		t.Fatalf("refused move changed %s's position", a.ID)
+	}
+	checkOccupancy(t, w)
+	w.Mu.Unlock()
+
+	for i := 0; i < 200; i += 2 {
+		w.RemoveMonster(fmt.Sprintf("m%d", i))
+	}
+	for i := 0; i < 50; i += 3 {
+		w.RemovePlayer(fmt.Sprintf("p%d", i))
+	}
+	// Freed tiles can be taken again.
+	populate(t, w, "new-", 100, 10)
+
+	w.Mu.Lock()
+	defer w.Mu.Unlock()
+	checkOccupancy(t, w)
+}
+
+// The scan benchmarks time the linear searches over Monsters and Players that the
+// occupancy index replaced, for comparison.
+
+func benchmarkWorld(b *testing.B) *World {
+	gen, _ := NewMapGenerator("cave")
+	w := NewWorld(512, 512, 42, gen)
+	populate(b, w, "", 5000, 2000)
+	return w
+}
+
+func scanMonsterAt(w *World, x, y int) *Monster {
+	for _, m := range w.Monsters {
+		if m.GetX() == x && m.GetY() == y {
+			return m
+		}
+	}
+	return nil
+}
+
+// scanMoveMonster is MoveMonster's occupancy check as a scan of every entity.
+func scanMoveMonster(w *World, m *Monster, newX, newY int) bool {
+	if !w.isSafeSpawn(newX, newY) {
+		return false
+	}
+	for _, other := range w.Monsters {
+		if other != m && other.GetX() == newX && other.GetY() == newY {
+			return false
+		}
+	}
+	for _, p := range w.Players {
+		if p.GetX() == newX && p.GetY() == newY {
+			return false
+		}
+	}
+	m.X, m.Y = newX, newY
+	return true
+}
+
+func BenchmarkGetMonsterAt(b *testing.B) {
+	lookups := []struct {
+		name   string
+		lookup func(w *World, x, y int) *Monster
+	}{
+		{"index", (*World).getMonsterAtInternal},
+		{"scan", scanMonsterAt},
+	}
+	for _, tc := range lookups {
+		b.Run(tc.name, func(b *testing.B) {
+			w := benchmarkWorld(b)
+			w.Mu.Lock()
+			defer w.Mu.Unlock()
+			rng := rand.New(rand.NewSource(1))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				tc.lookup(w, rng.Intn(w.Width), rng.Intn(w.Height))
+			}
+		})
+	}
+}
+
+func BenchmarkMoveMonster(b *testing.B) {
+	moves := []struct {
+		name string
+		move func(w *World, m *Monster, x, y int) bool
+	}{
+		{"index", (*World).MoveMonster},
+		{"scan", scanMoveMonster},
+	}
+	for _, tc := range moves {
+		b.Run(tc.name, func(b *testing.B) {
+			w := benchmarkWorld(b)
+			w.Mu.Lock()
+			defer w.Mu.Unlock()
+			monsters := make([]*Monster, 0, len(w.Monsters))
+			for _, m := range w.Monsters {
+				monsters = append(monsters, m)
+			}
+			rng := rand.New(rand.NewSource(1))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				m := monsters[i%len(monsters)]
+				step := steps[rng.Intn(len(steps))]
+				tc.move(w, m, m.X+step.X, m.Y+step.Y)
+			}
+		})
+	}
+}
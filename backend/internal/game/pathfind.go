@@ -0,0 +1,144 @@
+package game
+
+import "container/heap"
+
+// PathOptions tune FindPath for the walker asking.
+type PathOptions struct {
+	// AvoidHazards treats tiles that hurt to step on, such as lava, as walls.
+	AvoidHazards bool
+	// IgnoreOccupants plans through tiles taken by monsters and players. Otherwise
+	// they block, except for the goal itself so a path can lead up to a target.
+	IgnoreOccupants bool
+	// MaxNodes caps how many tiles the search expands before giving up. Zero means
+	// no cap beyond the size of the map.
+	MaxNodes int
+}
+
+type pathNode struct {
+	index    int
+	priority int // cost so far plus heuristic
+}
+
+type pathQueue []pathNode
+
+func (q pathQueue) Len() int           { return len(q) }
+func (q pathQueue) Less(i, j int) bool { return q[i].priority < q[j].priority }
+func (q pathQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q *pathQueue) Push(x any)        { *q = append(*q, x.(pathNode)) }
+func (q *pathQueue) Pop() any {
+	old := *q
+	n := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return n
+}
+
+// FindPath is FindPathInternal for callers that don't hold w.Mu.
+func (w *World) FindPath(from, to Point, opts PathOptions) ([]Point, bool) {
+	w.Mu.Lock()
+	defer w.Mu.Unlock()
+	return w.FindPathInternal(from, to, opts)
+}
+
+// FindPathInternal runs A* over the 4-connected tile grid, weighting each step by
+// the MoveCost of the tile entered. The path excludes from and ends at to; it is
+// empty when from == to. ok is false when to can't be reached.
+// Assumes w.Mu is HELD
+func (w *World) FindPathInternal(from, to Point, opts PathOptions) (path []Point, ok bool) {
+	if w.GetTile(from.X, from.Y) == nil || !w.pathEnterable(to, to, opts) {
+		return nil, false
+	}
+	if from == to {
+		return []Point{}, true
+	}
+
+	size := w.Width * w.Height
+	maxNodes := opts.MaxNodes
+	if maxNodes <= 0 || maxNodes > size {
+		maxNodes = size
+	}
+
+	start := from.Y*w.Width + from.X
+	goal := to.Y*w.Width + to.X
+	cost := make([]int, size)
+	cameFrom := make([]int, size)
+	closed := make([]bool, size)
+	for i := range cost {
+		cost[i] = -1
+	}
+	cost[start] = 0
+	cameFrom[start] = -1
+
+	open := &pathQueue{{index: start, priority: manhattan(from, to)}}
+	for expanded := 0; open.Len() > 0 && expanded < maxNodes; {
+		current := heap.Pop(open).(pathNode).index
+		if closed[current] {
+			continue // stale queue entry
+		}
+		if current == goal {
+			return w.buildPath(cameFrom, goal), true
+		}
+		closed[current] = true
+		expanded++
+
+		cx, cy := current%w.Width, current/w.Width
+		for _, off := range neighbourOffsets {
+			next := Point{X: cx + off.X, Y: cy + off.Y}
+			if !w.pathEnterable(next, to, opts) {
+				continue
+			}
+			i := next.Y*w.Width + next.X
+			if closed[i] {
+				continue
+			}
+			newCost := cost[current] + max(TileProps(w.Tiles[next.Y][next.X].Type).MoveCost, 1)
+			if cost[i] >= 0 && newCost >= cost[i] {
+				continue
+			}
+			cost[i] = newCost
+			cameFrom[i] = current
+			heap.Push(open, pathNode{index: i, priority: newCost + manhattan(next, to)})
+		}
+	}
+	return nil, false
+}
+
+// pathEnterable reports whether a walker may step onto p on its way to goal.
+// Assumes w.Mu is HELD
+func (w *World) pathEnterable(p, goal Point, opts PathOptions) bool {
+	tile := w.GetTile(p.X, p.Y)
+	if tile == nil {
+		return false
+	}
+	props := TileProps(tile.Type)
+	if !props.Passable || (opts.AvoidHazards && props.DamagePerStep > 0) {
+		return false
+	}
+	if !opts.IgnoreOccupants && p != goal && w.IsOccupiedInternal(p.X, p.Y) {
+		return false
+	}
+	return true
+}
+
+func (w *World) buildPath(cameFrom []int, goal int) []Point {
+	var path []Point
+	for i := goal; cameFrom[i] >= 0; i = cameFrom[i] {
+		path = append(path, Point{X: i % w.Width, Y: i / w.Width})
+	}
+	for l, r := 0, len(path)-1; l < r; l, r = l+1, r-1 {
+		path[l], path[r] = path[r], path[l]
+	}
+	return path
+}
+
+// manhattan is the A* heuristic. It never overestimates since every tile costs at
+// least 1 to enter.
+func manhattan(a, b Point) int {
+	dx, dy := a.X-b.X, a.Y-b.Y
+	if dx < 0 {
+		dx = -dx
+	}
+	if dy < 0 {
+		dy = -dy
+	}
+	return dx + dy
+}
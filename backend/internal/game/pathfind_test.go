@@ -0,0 +1,268 @@
+package game
+
+import (
+	"fmt"
+	"game-server/internal/protocol"
+	"strings"
+	"testing"
+)
+
+func TestFindPath(t *testing.T) {
+	tests := []struct {
+		name     string
+		rows     []string
+		from, to Point
+		opts     PathOptions
+		monsters []Point
+		players  []Point
+		wantOK   bool
+		wantLen  int
+		wantCost int
+	}{
+		{
+			name: "detours around rubble when walking round is cheaper",
+			rows: []string{
+				"#######",
+				"#.::..#",
+				"#.....#",
+				"#######",
+			},
+			from: Point{X: 1, Y: 1}, to: Point{X: 4, Y: 1},
+			wantOK: true, wantLen: 5, wantCost: 5,
+		},
+		{
+			name: "crosses rubble when the detour costs more",
+			rows: []string{
+				"#######",
+				"#.:...#",
+				"#.###.#",
+				"#.....#",
+				"#######",
+			},
+			from: Point{X: 1, Y: 1}, to: Point{X: 5, Y: 1},
+			wantOK: true, wantLen: 4, wantCost: 6,
+		},
+		{
+			name: "walks over lava by default",
+			rows: []string{
+				"#######",
+				"#..^..#",
+				"#.###.#",
+				"#.....#",
+				"#######",
+			},
+			from: Point{X: 1, Y: 1}, to: Point{X: 5, Y: 1},
+			wantOK: true, wantLen: 4, wantCost: 4,
+		},
+		{
+			name: "goes round lava when avoiding hazards",
+			rows: []string{
+				"#######",
+				"#..^..#",
+				"#.###.#",
+				"#.....#",
+				"#######",
+			},
+			from: Point{X: 1, Y: 1}, to: Point{X: 5, Y: 1},
+			opts:   PathOptions{AvoidHazards: true},
+			wantOK: true, wantLen: 8, wantCost: 8,
+		},
+		{
+			name: "no way past lava when avoiding hazards",
+			rows: []string{
+				"#####",
+				"#.^.#",
+				"#####",
+			},
+			from: Point{X: 1, Y: 1}, to: Point{X: 3, Y: 1},
+			opts: PathOptions{AvoidHazards: true},
+		},
+		{
+			name: "goal is a wall",
+			rows: []string{
+				"#####",
+				"#...#",
+				"#####",
+			},
+			from: Point{X: 1, Y: 1}, to: Point{X: 4, Y: 1},
+		},
+		{
+			name: "goal is walled off",
+			rows: []string{
+				"#####",
+				"#.#.#",
+				"#####",
+			},
+			from: Point{X: 1, Y: 1}, to: Point{X: 3, Y: 1},
+		},
+		{
+			name: "goal off the map",
+			rows: []string{
+				"#####",
+				"#...#",
+				"#####",
+			},
+			from: Point{X: 1, Y: 1}, to: Point{X: 9, Y: 1},
+		},
+		{
+			name: "monster on the goal is still reached",
+			rows: []string{
+				"#####",
+				"#...#",
+				"#####",
+			},
+			from: Point{X: 1, Y: 1}, to: Point{X: 3, Y: 1},
+			monsters: []Point{{X: 3, Y: 1}},
+			wantOK:   true, wantLen: 2, wantCost: 2,
+		},
+		{
+			name: "player on the goal is still reached",
+			rows: []string{
+				"#####",
+				"#...#",
+				"#####",
+			},
+			from: Point{X: 1, Y: 1}, to: Point{X: 3, Y: 1},
+			players: []Point{{X: 3, Y: 1}},
+			wantOK:  true, wantLen: 2, wantCost: 2,
+		},
+		{
+			name: "monster in the way blocks",
+			rows: []string{
+				"#####",
+				"#...#",
+				"#####",
+			},
+			from: Point{X: 1, Y: 1}, to: Point{X: 3, Y: 1},
+			monsters: []Point{{X: 2, Y: 1}},
+		},
+		{
+			name: "monster in the way is ignored on request",
+			rows: []string{
+				"#####",
+				"#...#",
+				"#####",
+			},
+			from: Point{X: 1, Y: 1}, to: Point{X: 3, Y: 1},
+			opts:     PathOptions{IgnoreOccupants: true},
+			monsters: []Point{{X: 2, Y: 1}},
+			wantOK:   true, wantLen: 2, wantCost: 2,
+		},
+		{
+			name: "from and to the same tile",
+			rows: []string{
+				"###",
+				"#.#",
+				"###",
+			},
+			from: Point{X: 1, Y: 1}, to: Point{X: 1, Y: 1},
+			wantOK: true,
+		},
+		{
+			name: "gives up after MaxNodes",
+			rows: []string{
+				"############",
+				"#..........#",
+				"############",
+			},
+			from: Point{X: 1, Y: 1}, to: Point{X: 10, Y: 1},
+			opts: PathOptions{MaxNodes: 5},
+		},
+		{
+			name: "MaxNodes large enough for the search",
+			rows: []string{
+				"############",
+				"#..........#",
+				"############",
+			},
+			from: Point{X: 1, Y: 1}, to: Point{X: 10, Y: 1},
+			opts:   PathOptions{MaxNodes: 10},
+			wantOK: true, wantLen: 9, wantCost: 9,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			w, err := LoadASCIIMap(strings.NewReader(strings.Join(tc.rows, "\n")), 1, nil)
+			if err != nil {
+				t.Fatalf("loading map: %v", err)
+			}
+			for i, p := range tc.monsters {
+				w.AddMonster(NewMonster(fmt.Sprintf("m%d", i), protocol.Goblin, w.Tuning.Monsters[protocol.Goblin], p.X, p.Y))
+			}
+			for i, p := range tc.players {
+				w.AddPlayer(NewPlayer(fmt.Sprintf("p%d", i), p.X, p.Y, w.Tuning))
+			}
+
+			path, ok := w.FindPath(tc.from, tc.to, tc.opts)
+			if ok != tc.wantOK {
+				t.Fatalf("ok = %v, want %v (path %v)", ok, tc.wantOK, path)
+			}
+			if !ok {
+				if path != nil {
+					t.Errorf("failed search returned path %v", path)
+				}
+				return
+			}
+			if path == nil {
+				t.Fatal("successful search returned a nil path")
+			}
+			if len(path) != tc.wantLen {
+				t.Fatalf("path %v has %d steps, want %d", path, len(path), tc.wantLen)
+			}
+
+			cost := 0
+			prev := tc.from
+			for _, p := range path {
+				if manhattan(prev, p) != 1 {
+					t.Fatalf("path %v jumps from %v to %v", path, prev, p)
+				}
+				if !w.pathEnterable(p, tc.to, tc.opts) {
+					t.Fatalf("path %v steps onto %v, which it may not enter", path, p)
+				}
+				cost += TileProps(w.Tiles[p.Y][p.X].Type).MoveCost
+				prev = p
+			}
+			if len(path) > 0 && path[len(path)-1] != tc.to {
+				t.Errorf("path %v ends at %v, want %v", path, path[len(path)-1], tc.to)
+			}
+			if cost != tc.wantCost {
+				t.Errorf("path %v costs %d, want %d", path, cost, tc.wantCost)
+			}
+		})
+	}
+}
+
+func benchmarkFindPath(b *testing.B, generator string) {
+	gen, err := NewMapGenerator(generator)
+	if err != nil {
+		b.Fatal(err)
+	}
+	w := NewWorld(256, 256, 42, gen)
+	if len(w.reachableTiles) < 2 {
+		b.Fatal("map has no connected region to path through")
+	}
+	// Path between the tiles of the main region nearest opposite corners.
+	from, to := w.reachableTiles[0], w.reachableTiles[0]
+	for _, p := range w.reachableTiles {
+		if p.X+p.Y < from.X+from.Y {
+			from = p
+		}
+		if p.X+p.Y > to.X+to.Y {
+			to = p
+		}
+	}
+	if _, ok := w.FindPathInternal(from, to, PathOptions{}); !ok {
+		b.Fatalf("no path from %v to %v", from, to)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w.FindPathInternal(from, to, PathOptions{})
+	}
+}
+
+func BenchmarkFindPath(b *testing.B) {
+	for _, generator := range []string{"bsp", "cave"} {
+		b.Run(generator, func(b *testing.B) { benchmarkFindPath(b, generator) })
+	}
+}
@@ -2,6 +2,7 @@ package game
 
 import (
 	"fmt"
+	"game-server/internal/protocol"
 	"log"
 )
 
@@ -20,18 +21,21 @@ type Player struct {
 	XPToNextLevel  int
 	IsInCombat     bool
 	CombatTargetID string
-}
 
-// TODO replace with math
-var xpThresholds = map[int]int{
-	1: 100,
-	2: 250,
-	3: 500,
-	4: 1000,
+	Effects Effects
+	// Resistances to damage types; players start with none.
+	Resistances Resistances
+
+	Inventory *Inventory
+	Equipment Equipment
 }
 
-func NewPlayer(id string, startX, startY int) *Player {
+func NewPlayer(id string, startX, startY int, tuning *Tuning) *Player {
 	initialLevel := 1
+	inventory := NewInventory(tuning.InventorySlots)
+	for _, stack := range tuning.StartingItems {
+		inventory.Add(stack.Item, stack.Count, tuning.Items[stack.Item])
+	}
 	return &Player{
 		ID:             id,
 		X:              startX,
@@ -42,20 +46,13 @@ func NewPlayer(id string, startX, startY int) *Player {
 		CurrentHP:      100,
 		Attack:         10,
 		Defense:        5,
-		XPToNextLevel:  CalculateXPToNextLevel(initialLevel),
+		XPToNextLevel:  tuning.XPToNextLevel(initialLevel),
 		IsInCombat:     false,
 		CombatTargetID: "",
+		Inventory:      inventory,
 	}
 }
 
-func CalculateXPToNextLevel(level int) int {
-	if nextXP, ok := xpThresholds[level]; ok {
-		return nextXP
-	}
-
-	return 1000 + (level-4)*500
-}
-
 func (p *Player) GetID() string {
 	return p.ID
 }
@@ -69,17 +66,27 @@ func (p *Player) GetY() int {
 }
 
 func (p *Player) Move(dx, dy int, world *World) (moved bool, engagedMonster *Monster) {
+	// A player removed from the world, e.g. a dropped client whose last messages
+	// are still being handled, must not be indexed on the map again.
+	if world.Players[p.GetID()] != p {
+		fmt.Printf("Player %s tried to move but is not in the world. Move denied.\n", p.GetID())
+		return false, nil
+	}
 	if p.IsInCombat {
 		fmt.Printf("Player %s tried to move while in combat. Move denied.\n", p.GetID())
 		return false, nil
 	}
+	if p.Effects.Stunned() {
+		fmt.Printf("Player %s tried to move while stunned. Move denied.\n", p.GetID())
+		return false, nil
+	}
 
 	newX, newY := p.X+dx, p.Y+dy
 
 	if monster := world.getMonsterAtInternal(newX, newY); monster != nil {
 		if monster.IsInCombat {
-			fmt.Printf("Player %s tried to engage Monster %s, but monster is already in combat with %s.\n", p.GetID(), monster.GetID(), monster.CombatTargetID)
-			return false, nil
+			fmt.Printf("Player %s joins the fight against Monster %s at (%d,%d).\n", p.GetID(), monster.GetID(), newX, newY)
+			return false, monster
 		}
 		fmt.Printf("Player %s attempts to engage Monster %s at (%d,%d).\n", p.GetID(), monster.GetID(), newX, newY)
 		return false, monster
@@ -89,14 +96,13 @@ func (p *Player) Move(dx, dy int, world *World) (moved bool, engagedMonster *Mon
 		if otherPlayer := world.getPlayerAtInternal(newX, newY); otherPlayer != nil && otherPlayer.GetID() != p.GetID() {
 			return false, nil
 		}
-		p.X = newX
-		p.Y = newY
+		world.occupied.movePlayer(p, newX, newY)
 		return true, nil
 	}
 	return false, nil
 }
 
-func (p *Player) GainXP(amount int) (leveledUp bool) {
+func (p *Player) GainXP(amount int, tuning *Tuning) (leveledUp bool) {
 	if amount <= 0 {
 		return false
 	}
@@ -104,16 +110,20 @@ func (p *Player) GainXP(amount int) (leveledUp bool) {
 	p.XP += amount
 	log.Printf("Player %s gained %d XP. Total XP: %d. Needed for next level: %d", p.GetID(), amount, p.XP, p.XPToNextLevel)
 
-	leveledUp = false
+	return p.applyLevelUps(tuning)
+}
+
+// applyLevelUps spends the player's XP on every level it already covers.
+func (p *Player) applyLevelUps(tuning *Tuning) (leveledUp bool) {
 	for p.XP >= p.XPToNextLevel {
 		p.XP -= p.XPToNextLevel
-		p.LevelUp()
+		p.LevelUp(tuning)
 		leveledUp = true
 	}
 	return leveledUp
 }
 
-func (p *Player) LevelUp() {
+func (p *Player) LevelUp(tuning *Tuning) {
 	p.Level++
 	log.Printf("Player %s LEVELED UP to Level %d!", p.GetID(), p.Level)
 
@@ -122,7 +132,7 @@ func (p *Player) LevelUp() {
 	p.Attack += 2
 	p.Defense += 1
 
-	p.XPToNextLevel = CalculateXPToNextLevel(p.Level)
+	p.XPToNextLevel = tuning.XPToNextLevel(p.Level)
 
 	log.Printf("Player %s new stats: Level %d, MaxHP %d, Attack %d, Defense %d, XP for next: %d",
 		p.GetID(), p.Level, p.MaxHP, p.Attack, p.Defense, p.XPToNextLevel)
@@ -157,14 +167,77 @@ func (p *Player) Heal(amount int) (actualHealAmount int) {
 	return actualHealAmount
 }
 
-func (p *Player) ResetToLevel1() {
+func (p *Player) ResetToLevel1(tuning *Tuning) {
 	p.Level = 1
 	p.XP = 0
 	p.MaxHP = 100
 	p.CurrentHP = p.MaxHP
 	p.Attack = 10
 	p.Defense = 5
-	p.XPToNextLevel = CalculateXPToNextLevel(p.Level)
+	p.XPToNextLevel = tuning.XPToNextLevel(p.Level)
 	p.IsInCombat = false
 	p.CombatTargetID = ""
+	p.Effects = nil
+}
+
+// EffectiveAttack and EffectiveDefense are the base stats plus the player's
+// equipment and status effects.
+func (p *Player) EffectiveAttack() int {
+	return max(p.Attack+p.Equipment.AttackMod()+p.Effects.AttackMod(), 0)
 }
+
+func (p *Player) EffectiveDefense() int {
+	return max(p.Defense+p.Equipment.DefenseMod()+p.Effects.DefenseMod(), 0)
+}
+
+func (p *Player) StatUpdatePayload() protocol.S2C_PlayerStatUpdatePayload {
+	return protocol.S2C_PlayerStatUpdatePayload{
+		PlayerID:      p.GetID(),
+		Level:         p.Level,
+		XP:            p.XP,
+		XPToNextLevel: p.XPToNextLevel,
+		MaxHP:         p.MaxHP,
+		CurrentHP:     p.CurrentHP,
+		Attack:        p.Attack,
+		Defense:       p.Defense,
+
+		EffectiveAttack:  p.EffectiveAttack(),
+		EffectiveDefense: p.EffectiveDefense(),
+		DamageType:       string(p.AttackDamageType()),
+		Equipment:        p.equipmentData(),
+	}
+}
+
+func (p *Player) equipmentData() []protocol.S2C_EquippedItemData {
+	data := []protocol.S2C_EquippedItemData{}
+	for _, kind := range EquipmentSlots {
+		if item, ok := p.Equipment[kind]; ok {
+			data = append(data, protocol.S2C_EquippedItemData{
+				Slot:       string(kind),
+				ItemID:     string(item.Item),
+				Name:       item.Def.Name,
+				AttackMod:  item.Def.AttackMod,
+				DefenseMod: item.Def.DefenseMod,
+				DamageType: string(item.Def.DamageType),
+			})
+		}
+	}
+	return data
+}
+
+// AttackDamageType is what the player's weapon deals; bare hands are physical.
+func (p *Player) AttackDamageType() DamageType {
+	if weapon, ok := p.Equipment[ItemWeapon]; ok && weapon.Def.DamageType != "" {
+		return weapon.Def.DamageType
+	}
+	return DamagePhysical
+}
+
+// DamageResistances are the player's own plus those of their equipment.
+func (p *Player) DamageResistances() Resistances {
+	return p.Equipment.withResistances(p.Resistances)
+}
+
+func (p *Player) effectList() *Effects { return &p.Effects }
+func (p *Player) entityType() string   { return protocol.EntityTypePlayer }
+func (p *Player) currentHP() int       { return p.CurrentHP }
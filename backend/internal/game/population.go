@@ -0,0 +1,232 @@
+package game
+
+import (
+	"encoding/json"
+	"fmt"
+	"game-server/internal/config"
+	"game-server/internal/protocol"
+	"log"
+	"sort"
+	"time"
+)
+
+// Population describes how many monsters a floor keeps alive and how they come back.
+type Population struct {
+	// Count monsters of types picked by spawn weight. Maps with monster spawn
+	// markers use one per marker instead.
+	Count int
+	// Types and Regions add monsters of a fixed type, or kept inside a named
+	// region, on top of Count.
+	Types   map[protocol.MonsterType]int
+	Regions map[string]int
+	// RespawnDelay is how long a dead monster stays dead; zero means forever.
+	RespawnDelay time.Duration
+	// MinPlayerDistance keeps respawns out of sight, in steps from any player.
+	MinPlayerDistance int
+}
+
+// PopulationFromConfig reads the population settings from cfg.
+func PopulationFromConfig(cfg *config.Config) Population {
+	pop := Population{
+		Count:             cfg.InitialMonsterCount,
+		Types:             make(map[protocol.MonsterType]int, len(cfg.MonsterTargets)),
+		Regions:           cfg.RegionMonsterTargets,
+		RespawnDelay:      cfg.RespawnDelay,
+		MinPlayerDistance: cfg.RespawnMinPlayerDistance,
+	}
+	for name, n := range cfg.MonsterTargets {
+		pop.Types[protocol.MonsterType(name)] = n
+	}
+	return pop
+}
+
+// spawnSlot is one monster the population controller keeps alive. Whenever its
+// monster dies a new one is spawned for the same slot.
+type spawnSlot struct {
+	Type   protocol.MonsterType // empty picks by spawn weight on every spawn
+	Region *Region              // nil means anywhere reachable
+	Marker *Point               // preferred tile, from a map spawn marker
+}
+
+// SpawnInitialMonsters places count monsters that never respawn. See Populate.
+func (w *World) SpawnInitialMonsters(count int) {
+	w.Populate(Population{Count: count})
+}
+
+// Populate spawns the floor's monsters and, when pop.RespawnDelay is set, replaces
+// each one that dies after that delay.
+func (w *World) Populate(pop Population) {
+	w.Mu.Lock()
+	defer w.Mu.Unlock()
+
+	w.population = pop
+	var slots []*spawnSlot
+	if len(w.MonsterSpawns) > 0 {
+		for _, spawn := range w.MonsterSpawns {
+			slots = append(slots, &spawnSlot{Type: spawn.Type, Marker: &Point{X: spawn.X, Y: spawn.Y}})
+		}
+	} else {
+		for i := 0; i < pop.Count; i++ {
+			slots = append(slots, &spawnSlot{})
+		}
+	}
+
+	// Sorted so the same seed always gives the same monsters.
+	types := make([]protocol.MonsterType, 0, len(pop.Types))
+	for mType := range pop.Types {
+		types = append(types, mType)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	for _, mType := range types {
+		for i := 0; i < pop.Types[mType]; i++ {
+			slots = append(slots, &spawnSlot{Type: mType})
+		}
+	}
+
+	regions := make([]string, 0, len(pop.Regions))
+	for name := range pop.Regions {
+		regions = append(regions, name)
+	}
+	sort.Strings(regions)
+	for _, name := range regions {
+		region := w.regionByName(name)
+		if region == nil {
+			log.Printf("Floor %d has no region %q for its monster target, skipping it.", w.Depth, name)
+			continue
+		}
+		for i := 0; i < pop.Regions[name]; i++ {
+			slots = append(slots, &spawnSlot{Region: region})
+		}
+	}
+
+	spawned := 0
+	for _, slot := range slots {
+		if w.spawnInSlotInternal(slot, false) != nil {
+			spawned++
+		}
+	}
+	if spawned < len(slots) {
+		log.Printf("No free reachable tile left, spawned %d of %d monsters.", spawned, len(slots))
+	}
+}
+
+// spawnInSlotInternal creates a monster for slot on a free tile, announcing it when
+// announce is set. It returns nil if there is no suitable tile.
+// Assumes w.Mu is HELD
+func (w *World) spawnInSlotInternal(slot *spawnSlot, announce bool) *Monster {
+	x, y, ok := w.findSlotTile(slot)
+	if !ok {
+		return nil
+	}
+	mType := slot.Type
+	if mType == "" {
+		mType = w.Tuning.pickMonsterType(w.rng, w.Depth)
+	}
+	id := fmt.Sprintf("monster-%d-%03d", w.Depth, w.monsterSeq)
+	w.monsterSeq++
+
+	m := NewMonster(id, mType, w.Tuning.MonsterStats(mType, w.Depth), x, y)
+	m.slot = slot
+	w.addMonsterInternal(m)
+
+	if announce && w.hub != nil {
+		spawnedPayload := protocol.S2C_MonsterSpawnedPayload{
+			S2C_MonsterData: protocol.S2C_MonsterData{
+				ID:        m.GetID(),
+				X:         m.GetX(),
+				Y:         m.GetY(),
+				Type:      m.Type,
+				Name:      m.Name,
+				Glyph:     m.Glyph,
+				MaxHP:     m.MaxHP,
+				CurrentHP: m.CurrentHP,
+			},
+		}
+		msg := protocol.GenericMessage{
+			Type:    protocol.S2C_MessageTypeMonsterSpawned,
+			Payload: spawnedPayload,
+		}
+		jsonMsg, err := json.Marshal(msg)
+		if err != nil {
+			log.Printf("Error marshaling monster spawned message for %s: %v", m.GetID(), err)
+		} else {
+			w.hub.Broadcast(jsonMsg)
+		}
+	}
+	return m
+}
+
+// scheduleRespawnInternal brings a dead monster's slot back after the respawn
+// delay, trying again a delay later while there is nowhere to put it.
+// Assumes w.Mu is HELD
+func (w *World) scheduleRespawnInternal(slot *spawnSlot) {
+	if w.population.RespawnDelay <= 0 {
+		return
+	}
+	w.ScheduleInternal(w.TicksFor(w.population.RespawnDelay), func() {
+		if m := w.spawnInSlotInternal(slot, true); m != nil {
+			log.Printf("Monster %s (%s) respawned at (%d,%d) on floor %d.", m.ID, m.Name, m.X, m.Y, w.Depth)
+			return
+		}
+		w.scheduleRespawnInternal(slot)
+	})
+}
+
+// findSlotTile picks a safe, free tile for slot that is far enough from every
+// player: the slot's marker if possible, then a tile in its region or anywhere
+// reachable.
+// Assumes w.Mu is HELD
+func (w *World) findSlotTile(slot *spawnSlot) (x, y int, ok bool) {
+	usable := func(p Point) bool {
+		return w.isSafeSpawn(p.X, p.Y) && !w.IsOccupiedInternal(p.X, p.Y) && w.farFromPlayers(p)
+	}
+
+	if slot.Marker != nil && usable(*slot.Marker) {
+		return slot.Marker.X, slot.Marker.Y, true
+	}
+
+	candidates := w.reachableTiles
+	if slot.Region != nil {
+		candidates = nil
+		for y := slot.Region.Y; y < slot.Region.Y+slot.Region.H; y++ {
+			for x := slot.Region.X; x < slot.Region.X+slot.Region.W; x++ {
+				candidates = append(candidates, Point{X: x, Y: y})
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return 0, 0, false
+	}
+
+	for i := 0; i < 32; i++ {
+		p := candidates[w.rng.Intn(len(candidates))]
+		if usable(p) {
+			return p.X, p.Y, true
+		}
+	}
+	for _, p := range candidates {
+		if usable(p) {
+			return p.X, p.Y, true
+		}
+	}
+	return 0, 0, false
+}
+
+// Assumes w.Mu is HELD
+func (w *World) farFromPlayers(p Point) bool {
+	for _, player := range w.Players {
+		if manhattan(p, Point{X: player.X, Y: player.Y}) < w.population.MinPlayerDistance {
+			return false
+		}
+	}
+	return true
+}
+
+func (w *World) regionByName(name string) *Region {
+	for i := range w.Regions {
+		if w.Regions[i].Name == name {
+			return &w.Regions[i]
+		}
+	}
+	return nil
+}
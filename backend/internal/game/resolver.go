@@ -0,0 +1,85 @@
+package game
+
+import (
+	"math"
+	"math/rand"
+)
+
+// AttackRoll is one attack for a CombatResolver to resolve.
+type AttackRoll struct {
+	Attack  int
+	Defense int
+	Type    DamageType
+	// Resistances are the defender's.
+	Resistances Resistances
+}
+
+// AttackOutcome is how a single attack landed.
+type AttackOutcome struct {
+	Hit      bool
+	Critical bool
+	// Damage is never negative and always zero on a miss.
+	Damage        int
+	Type          DamageType
+	Effectiveness string
+}
+
+// CombatResolver decides how attacks land. The World calls it with Mu held, so an
+// implementation doesn't need its own locking.
+type CombatResolver interface {
+	ResolveAttack(roll AttackRoll, t *Tuning) AttackOutcome
+}
+
+// StandardResolver hits with Tuning.HitChance and rolls the damage: Attack - Defense
+// for physical attacks, and for the other types Attack less ElementalDefense of the
+// Defense, times ElementalPower. That is scaled by the defender's resistance, varied
+// by up to DamageVariance either way and multiplied by CritMultiplier on a critical
+// hit.
+type StandardResolver struct {
+	rng *rand.Rand
+}
+
+// NewStandardResolver rolls with rng; give it a seeded source to replay fights.
+func NewStandardResolver(rng *rand.Rand) *StandardResolver {
+	return &StandardResolver{rng: rng}
+}
+
+func (r *StandardResolver) ResolveAttack(roll AttackRoll, t *Tuning) AttackOutcome {
+	outcome := AttackOutcome{Type: roll.Type, Effectiveness: roll.Resistances.Effectiveness(roll.Type)}
+	if r.rng.Float64() >= t.HitChance {
+		return outcome
+	}
+	outcome.Hit = true
+	outcome.Critical = r.rng.Float64() < t.CritChance
+
+	base := float64(max(roll.Attack-roll.Defense, 0))
+	if roll.Type != DamagePhysical {
+		base = max(float64(roll.Attack)-float64(roll.Defense)*t.ElementalDefense, 0) * t.ElementalPower
+	}
+	damage := base * roll.Resistances.Multiplier(roll.Type)
+	damage *= 1 + t.DamageVariance*(2*r.rng.Float64()-1)
+	if outcome.Critical {
+		damage *= t.CritMultiplier
+	}
+	outcome.Damage = max(int(math.Round(damage)), 0)
+	return outcome
+}
+
+// SetCombatResolver replaces how this floor's attacks are resolved.
+func (w *World) SetCombatResolver(resolver CombatResolver) {
+	w.Mu.Lock()
+	defer w.Mu.Unlock()
+	w.resolver = resolver
+}
+
+// ResolveAttackInternal rolls one attack of the attacker's damage type with the
+// floor's resolver and tuning.
+// Assumes w.Mu is HELD
+func (w *World) ResolveAttackInternal(attacker, defender Combatant) AttackOutcome {
+	return w.resolver.ResolveAttack(AttackRoll{
+		Attack:      attacker.EffectiveAttack(),
+		Defense:     defender.EffectiveDefense(),
+		Type:        attacker.AttackDamageType(),
+		Resistances: defender.DamageResistances(),
+	}, w.Tuning)
+}
@@ -0,0 +1,274 @@
+package game
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"game-server/internal/protocol"
+	"io"
+	"os"
+	"strings"
+)
+
+// Tiled stores flip and rotation flags in the top bits of every GID.
+const tiledGIDMask = 0x0FFFFFFF
+
+// Region is a named area from a Tiled object layer, in tile coordinates.
+type Region struct {
+	Name  string
+	Class string
+	X, Y  int
+	W, H  int
+}
+
+func (r Region) Contains(x, y int) bool {
+	return x >= r.X && x < r.X+r.W && y >= r.Y && y < r.Y+r.H
+}
+
+// DefaultTiledGIDs matches a tileset whose first tile is grass and second is stone.
+func DefaultTiledGIDs() map[uint32]protocol.TileType {
+	return map[uint32]protocol.TileType{
+		1: protocol.Grass,
+		2: protocol.Stone,
+	}
+}
+
+type tiledMap struct {
+	Width      int          `json:"width"`
+	Height     int          `json:"height"`
+	TileWidth  int          `json:"tilewidth"`
+	TileHeight int          `json:"tileheight"`
+	Infinite   bool         `json:"infinite"`
+	Layers     []tiledLayer `json:"layers"`
+}
+
+type tiledLayer struct {
+	Name        string          `json:"name"`
+	Type        string          `json:"type"`
+	Visible     *bool           `json:"visible"`
+	Width       int             `json:"width"`
+	Height      int             `json:"height"`
+	Data        json.RawMessage `json:"data"`
+	Encoding    string          `json:"encoding"`
+	Compression string          `json:"compression"`
+	Objects     []tiledObject   `json:"objects"`
+	Layers      []tiledLayer    `json:"layers"` // group layers
+}
+
+type tiledObject struct {
+	Name       string          `json:"name"`
+	Type       string          `json:"type"`  // Tiled < 1.9
+	Class      string          `json:"class"` // Tiled >= 1.9
+	X          float64         `json:"x"`
+	Y          float64         `json:"y"`
+	Width      float64         `json:"width"`
+	Height     float64         `json:"height"`
+	Properties []tiledProperty `json:"properties"`
+}
+
+type tiledProperty struct {
+	Name  string      `json:"name"`
+	Value interface{} `json:"value"`
+}
+
+func (o tiledObject) class() string {
+	if o.Class != "" {
+		return o.Class
+	}
+	return o.Type
+}
+
+func (o tiledObject) property(name string) string {
+	for _, p := range o.Properties {
+		if p.Name == name {
+			return fmt.Sprint(p.Value)
+		}
+	}
+	return ""
+}
+
+// LoadTiledMapFile imports a map exported from the Tiled editor as JSON.
+//
+// Tile layers are stacked in order, later non-empty tiles winning, and each GID is
+// looked up in gids (DefaultTiledGIDs when nil). Tiles left empty by every layer
+// become stone. Objects on object layers are read by class:
+//
+//	player_spawn   a player spawn point
+//	monster_spawn  a monster spawn; the monster_type property picks the type
+//	anything else  a named Region
+func LoadTiledMapFile(path string, seed int64, gids map[uint32]protocol.TileType) (*World, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading Tiled map %s: %w", path, err)
+	}
+	world, err := LoadTiledMap(data, seed, gids)
+	if err != nil {
+		return nil, fmt.Errorf("Tiled map %s: %w", path, err)
+	}
+	return world, nil
+}
+
+func LoadTiledMap(data []byte, seed int64, gids map[uint32]protocol.TileType) (*World, error) {
+	if gids == nil {
+		gids = DefaultTiledGIDs()
+	}
+
+	var tm tiledMap
+	if err := json.Unmarshal(data, &tm); err != nil {
+		return nil, fmt.Errorf("parsing JSON: %w", err)
+	}
+	if tm.Infinite {
+		return nil, fmt.Errorf("infinite maps are not supported")
+	}
+	if tm.Width <= 0 || tm.Height <= 0 || tm.TileWidth <= 0 || tm.TileHeight <= 0 {
+		return nil, fmt.Errorf("invalid map size %dx%d with %dx%d tiles", tm.Width, tm.Height, tm.TileWidth, tm.TileHeight)
+	}
+
+	tiles := newTileGrid(tm.Width, tm.Height, protocol.Stone)
+	var playerSpawns []Point
+	var monsterSpawns []MonsterSpawn
+	var regions []Region
+
+	var visit func(layers []tiledLayer) error
+	visit = func(layers []tiledLayer) error {
+		for _, layer := range layers {
+			if layer.Visible != nil && !*layer.Visible {
+				continue
+			}
+			switch layer.Type {
+			case "tilelayer":
+				if err := applyTileLayer(tiles, layer, gids); err != nil {
+					return fmt.Errorf("layer %q: %w", layer.Name, err)
+				}
+			case "objectgroup":
+				for _, obj := range layer.Objects {
+					// Points have no size; rectangles spawn from their centre.
+					cx := int((obj.X + obj.Width/2) / float64(tm.TileWidth))
+					cy := int((obj.Y + obj.Height/2) / float64(tm.TileHeight))
+					if cx < 0 || cy < 0 || cx >= tm.Width || cy >= tm.Height {
+						return fmt.Errorf("layer %q: object %q lies outside the map", layer.Name, obj.Name)
+					}
+
+					switch obj.class() {
+					case "player_spawn":
+						playerSpawns = append(playerSpawns, Point{X: cx, Y: cy})
+					case "monster_spawn":
+						monsterSpawns = append(monsterSpawns, MonsterSpawn{
+							Type: protocol.MonsterType(obj.property("monster_type")),
+							X:    cx,
+							Y:    cy,
+						})
+					default:
+						regions = append(regions, Region{
+							Name:  obj.Name,
+							Class: obj.class(),
+							X:     int(obj.X) / tm.TileWidth,
+							Y:     int(obj.Y) / tm.TileHeight,
+							W:     max(1, int(obj.Width)/tm.TileWidth),
+							H:     max(1, int(obj.Height)/tm.TileHeight),
+						})
+					}
+				}
+			case "group":
+				if err := visit(layer.Layers); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if err := visit(tm.Layers); err != nil {
+		return nil, err
+	}
+
+	world := newWorldFromTiles(tiles, seed)
+	world.PlayerSpawns = playerSpawns
+	world.MonsterSpawns = monsterSpawns
+	world.Regions = regions
+	world.computeReachable()
+	world.warnUnreachableSpawns()
+	return world, nil
+}
+
+func applyTileLayer(tiles [][]Tile, layer tiledLayer, gids map[uint32]protocol.TileType) error {
+	height := len(tiles)
+	width := len(tiles[0])
+	if layer.Width != width || layer.Height != height {
+		return fmt.Errorf("layer is %dx%d but the map is %dx%d", layer.Width, layer.Height, width, height)
+	}
+
+	cells, err := decodeLayerData(layer)
+	if err != nil {
+		return err
+	}
+	if len(cells) != width*height {
+		return fmt.Errorf("layer has %d tiles, expected %d", len(cells), width*height)
+	}
+
+	for i, raw := range cells {
+		gid := raw & tiledGIDMask
+		if gid == 0 {
+			continue
+		}
+		tileType, ok := gids[gid]
+		if !ok {
+			return fmt.Errorf("tile %d at (%d,%d) has no entry in the GID table", gid, i%width, i/width)
+		}
+		tiles[i/width][i%width].Type = tileType
+	}
+	return nil
+}
+
+func decodeLayerData(layer tiledLayer) ([]uint32, error) {
+	if layer.Encoding == "" || layer.Encoding == "csv" {
+		var cells []uint32
+		if err := json.Unmarshal(layer.Data, &cells); err != nil {
+			return nil, fmt.Errorf("decoding tile data: %w", err)
+		}
+		return cells, nil
+	}
+	if layer.Encoding != "base64" {
+		return nil, fmt.Errorf("unsupported encoding %q", layer.Encoding)
+	}
+
+	var encoded string
+	if err := json.Unmarshal(layer.Data, &encoded); err != nil {
+		return nil, fmt.Errorf("decoding tile data: %w", err)
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("decoding base64 tile data: %w", err)
+	}
+
+	var r io.Reader = bytes.NewReader(raw)
+	switch layer.Compression {
+	case "":
+	case "zlib":
+		if r, err = zlib.NewReader(r); err != nil {
+			return nil, fmt.Errorf("decompressing tile data: %w", err)
+		}
+	case "gzip":
+		if r, err = gzip.NewReader(r); err != nil {
+			return nil, fmt.Errorf("decompressing tile data: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported compression %q", layer.Compression)
+	}
+
+	raw, err = io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("decompressing tile data: %w", err)
+	}
+	if len(raw)%4 != 0 {
+		return nil, fmt.Errorf("tile data length %d is not a multiple of 4", len(raw))
+	}
+	cells := make([]uint32, len(raw)/4)
+	for i := range cells {
+		cells[i] = binary.LittleEndian.Uint32(raw[i*4:])
+	}
+	return cells, nil
+}
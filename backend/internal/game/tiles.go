@@ -0,0 +1,84 @@
+package game
+
+import (
+	"fmt"
+	"game-server/internal/protocol"
+	"strings"
+)
+
+// TileProperties describes how a tile type behaves. Every rule about tiles should
+// come from here rather than from checks on specific tile types.
+type TileProperties struct {
+	Name          string
+	Glyph         rune
+	Passable      bool
+	BlocksSight   bool
+	MoveCost      int // cost of entering the tile, used by pathfinding; 1 is normal
+	DamagePerStep int // damage taken by a player entering the tile
+	// StepMessage tells a player who took DamagePerStep what hurt them, such as
+	// "The lava burns you". The damage is appended.
+	StepMessage string
+}
+
+var tileRegistry = map[protocol.TileType]TileProperties{
+	protocol.Grass:  {Name: "grass", Glyph: '.', Passable: true, MoveCost: 1},
+	protocol.Stone:  {Name: "stone", Glyph: '#', BlocksSight: true},
+	protocol.Water:  {Name: "water", Glyph: '~'},
+	protocol.Lava:   {Name: "lava", Glyph: '^', Passable: true, MoveCost: 1, DamagePerStep: 10, StepMessage: "The lava burns you"},
+	protocol.Door:   {Name: "door", Glyph: '+', Passable: true, BlocksSight: true, MoveCost: 1},
+	protocol.Bridge: {Name: "bridge", Glyph: '=', Passable: true, MoveCost: 1},
+	protocol.Rubble: {Name: "rubble", Glyph: ':', Passable: true, MoveCost: 3},
+
+	protocol.StairsDown: {Name: "stairs_down", Glyph: '>', Passable: true, MoveCost: 1},
+	protocol.StairsUp:   {Name: "stairs_up", Glyph: '<', Passable: true, MoveCost: 1},
+}
+
+// StepDamageMessage is the notification for a player hurt by entering the tile.
+func (t TileProperties) StepDamageMessage(damage int) string {
+	msg := t.StepMessage
+	if msg == "" {
+		msg = fmt.Sprintf("The %s hurts you", t.Name)
+	}
+	return fmt.Sprintf("%s for %d damage.", msg, damage)
+}
+
+var unknownTile = TileProperties{Name: "unknown", Glyph: '?', BlocksSight: true}
+
+// RegisterTile adds or replaces a tile type. It is not safe to call once worlds are
+// running; register custom tiles during startup.
+func RegisterTile(t protocol.TileType, props TileProperties) {
+	tileRegistry[t] = props
+}
+
+// TileProps returns the properties of t. Unknown types are impassable.
+func TileProps(t protocol.TileType) TileProperties {
+	if props, ok := tileRegistry[t]; ok {
+		return props
+	}
+	return unknownTile
+}
+
+func TileTypeByName(name string) (protocol.TileType, bool) {
+	for t, props := range tileRegistry {
+		if strings.EqualFold(props.Name, name) {
+			return t, true
+		}
+	}
+	return 0, false
+}
+
+func TileTypeByGlyph(glyph rune) (protocol.TileType, bool) {
+	for t, props := range tileRegistry {
+		if props.Glyph == glyph {
+			return t, true
+		}
+	}
+	return 0, false
+}
+
+// isSafeSpawn reports whether an entity can be placed on (x, y) without walking
+// into harm on arrival.
+func (w *World) isSafeSpawn(x, y int) bool {
+	tile := w.GetTile(x, y)
+	return tile != nil && TileProps(tile.Type).Passable && TileProps(tile.Type).DamagePerStep == 0
+}
@@ -0,0 +1,489 @@
+package game
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"game-server/internal/protocol"
+	"image/color"
+	"maps"
+	"math/rand"
+	"os"
+	"slices"
+	"sort"
+	"unicode/utf8"
+)
+
+// MonsterBehaviour selects how a monster's AI spends its turns.
+type MonsterBehaviour string
+
+const (
+	// BehaviourHunt wanders and chases players that come within AggroRadius.
+	BehaviourHunt MonsterBehaviour = "hunt"
+	// BehaviourWander only ever wanders and fights back when attacked.
+	BehaviourWander MonsterBehaviour = "wander"
+	// BehaviourGuard stands still until a player comes within AggroRadius.
+	BehaviourGuard MonsterBehaviour = "guard"
+)
+
+// defaultMonstersJSON is the built-in monster table, in the same format as
+// Config.MonstersFile.
+//
+//go:embed monsters.json
+var defaultMonstersJSON []byte
+
+// MonsterStats is one archetype in the monster table: everything needed to spawn a
+// monster of that type and run its AI.
+type MonsterStats struct {
+	Name  string `json:"name"`
+	Glyph string `json:"glyph"` // a single character, used by map dumps and clients
+	// Color is how map images draw the archetype, as "#rrggbb". Empty picks one
+	// from the type name.
+	Color   string `json:"color"`
+	MaxHP   int    `json:"max_hp"`
+	Attack  int    `json:"attack"`
+	Defense int    `json:"defense"`
+	XPValue int    `json:"xp_value"`
+
+	Behaviour MonsterBehaviour `json:"behaviour"`
+	// AggroRadius is how close, in steps, a player has to come before the monster
+	// hunts it. GiveUpDistance is how far the player has to get away to shake it
+	// off again. Neither scales with depth.
+	AggroRadius    int `json:"aggro_radius"`
+	GiveUpDistance int `json:"give_up_distance"`
+	// OnHit are the status effects the monster's attacks may apply.
+	OnHit []OnHitEffect `json:"on_hit"`
+	// DamageType is what the monster's attacks deal, physical if empty.
+	DamageType  DamageType  `json:"damage_type"`
+	Resistances Resistances `json:"resistances"`
+	// Loot is rolled when the monster dies; see LootTable.
+	Loot LootTable `json:"loot"`
+
+	// SpawnWeight is the relative chance of this type being picked when spawning
+	// on a floor at least MinDepth deep.
+	SpawnWeight int `json:"spawn_weight"`
+	MinDepth    int `json:"min_depth"`
+}
+
+// Tuning holds the gameplay values that can be changed while the server is running.
+// A Tuning is never modified once it has been applied to a World; reloading builds a
+// new one and swaps it in with ApplyTuning.
+type Tuning struct {
+	// XPThresholds maps a level to the XP needed to reach the next one. Levels past
+	// the table grow by XPStep per level.
+	XPThresholds map[int]int `json:"xp_thresholds"`
+	XPStep       int         `json:"xp_step"`
+	// Monsters is the archetype table, normally loaded from monsters.json or
+	// Config.MonstersFile. A tuning file can still adjust single fields.
+	Monsters map[protocol.MonsterType]MonsterStats `json:"monsters"`
+	// DepthScaling is how much stronger monsters get per dungeon floor, e.g. 0.25
+	// adds 25% HP, attack, defense and XP per floor below the first.
+	DepthScaling float64 `json:"depth_scaling"`
+	// A flee succeeds with FleeBaseChance plus FleeChancePerPoint for every point
+	// the player's defense exceeds the monster's attack (less when it falls short),
+	// kept between 5% and 95%.
+	FleeBaseChance     float64 `json:"flee_base_chance"`
+	FleeChancePerPoint float64 `json:"flee_chance_per_point"`
+	// Attack rolls for StandardResolver. DamageVariance of 0.2 spreads damage
+	// between 80% and 120% of Attack - Defense. Fire, frost and poison attacks
+	// are only blocked by ElementalDefense of the Defense but deal ElementalPower
+	// of what is left.
+	HitChance        float64 `json:"hit_chance"`
+	CritChance       float64 `json:"crit_chance"`
+	CritMultiplier   float64 `json:"crit_multiplier"`
+	DamageVariance   float64 `json:"damage_variance"`
+	ElementalPower   float64 `json:"elemental_power"`
+	ElementalDefense float64 `json:"elemental_defense"`
+	// Effects are the status effects monsters and items can apply, by ID.
+	Effects map[EffectID]EffectDef `json:"effects"`
+	// Items is the item table, normally items.json. New players get
+	// StartingItems in an inventory of InventorySlots slots.
+	Items          map[ItemID]ItemDef `json:"items"`
+	InventorySlots int                `json:"inventory_slots"`
+	StartingItems  []ItemStack        `json:"starting_items"`
+	// LootDespawnMs is how long items left on the ground last.
+	LootDespawnMs int `json:"loot_despawn_ms"`
+}
+
+var fallbackMonsterStats = MonsterStats{
+	Name:    "Mysterious Creature",
+	Glyph:   "M",
+	MaxHP:   50,
+	Attack:  10,
+	Defense: 5,
+	XPValue: 15,
+
+	Behaviour:      BehaviourHunt,
+	AggroRadius:    4,
+	GiveUpDistance: 8,
+}
+
+func DefaultTuning() *Tuning {
+	return &Tuning{
+		XPThresholds: map[int]int{
+			1: 100,
+			2: 250,
+			3: 500,
+			4: 1000,
+		},
+		XPStep:       500,
+		Monsters:     maps.Clone(defaultMonsters),
+		DepthScaling: 0.25,
+
+		FleeBaseChance:     0.6,
+		FleeChancePerPoint: 0.03,
+
+		HitChance:        0.9,
+		CritChance:       0.05,
+		CritMultiplier:   2,
+		DamageVariance:   0.2,
+		ElementalPower:   0.8,
+		ElementalDefense: 0.5,
+
+		Effects: defaultEffects(),
+
+		Items:          maps.Clone(defaultItems),
+		InventorySlots: 16,
+		StartingItems:  []ItemStack{{Item: ItemHealingPotion, Count: 3}},
+		LootDespawnMs:  60000,
+	}
+}
+
+var defaultMonsters = func() map[protocol.MonsterType]MonsterStats {
+	monsters, err := ParseMonsters(defaultMonstersJSON)
+	if err != nil {
+		panic(fmt.Sprintf("built-in monsters.json: %v", err))
+	}
+	return monsters
+}()
+
+// LoadMonsters reads a monster table that replaces the built-in one. See
+// monsters.json for the format; the keys are the monster type IDs used by map spawn
+// markers and sent to clients.
+func LoadMonsters(path string) (map[protocol.MonsterType]MonsterStats, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading monsters file %s: %w", path, err)
+	}
+	monsters, err := ParseMonsters(data)
+	if err != nil {
+		return nil, fmt.Errorf("monsters file %s: %w", path, err)
+	}
+	return monsters, nil
+}
+
+// ParseMonsters decodes a monster table. Fields an entry leaves out take the
+// fallback creature's values.
+func ParseMonsters(data []byte) (map[protocol.MonsterType]MonsterStats, error) {
+	var raw map[protocol.MonsterType]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("parsing JSON: %w", err)
+	}
+	monsters := make(map[protocol.MonsterType]MonsterStats, len(raw))
+	for mType, entry := range raw {
+		stats := fallbackMonsterStats
+		stats.Name = string(mType)
+		if err := json.Unmarshal(entry, &stats); err != nil {
+			return nil, fmt.Errorf("monster %s: %w", mType, err)
+		}
+		monsters[mType] = stats
+	}
+	if err := validateMonsters(monsters); err != nil {
+		return nil, err
+	}
+	return monsters, nil
+}
+
+// LoadTuning reads a JSON tuning file. Sections missing from the file keep the values
+// from base; map sections are merged key by key.
+func LoadTuning(path string, base *Tuning) (*Tuning, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading tuning file %s: %w", path, err)
+	}
+
+	t := base.clone()
+	if err := json.Unmarshal(data, t); err != nil {
+		return nil, fmt.Errorf("parsing tuning file %s: %w", path, err)
+	}
+
+	// Map values are decoded from scratch, so a monster entry that only sets "attack"
+	// would zero the rest. Decode each entry again on top of the base stats instead.
+	var monsters struct {
+		Monsters map[protocol.MonsterType]json.RawMessage `json:"monsters"`
+	}
+	if err := json.Unmarshal(data, &monsters); err != nil {
+		return nil, fmt.Errorf("parsing tuning file %s: %w", path, err)
+	}
+	for mType, raw := range monsters.Monsters {
+		stats, ok := base.Monsters[mType]
+		if !ok {
+			stats = fallbackMonsterStats
+		}
+		// Decoding would write into the base's map and slices otherwise.
+		stats.Resistances = maps.Clone(stats.Resistances)
+		stats.OnHit = slices.Clone(stats.OnHit)
+		stats.Loot = slices.Clone(stats.Loot)
+		if err := json.Unmarshal(raw, &stats); err != nil {
+			return nil, fmt.Errorf("parsing tuning file %s: monster %s: %w", path, mType, err)
+		}
+		t.Monsters[mType] = stats
+	}
+	// Effects and items get the same treatment.
+	var effects struct {
+		Effects map[EffectID]json.RawMessage `json:"effects"`
+	}
+	if err := json.Unmarshal(data, &effects); err != nil {
+		return nil, fmt.Errorf("parsing tuning file %s: %w", path, err)
+	}
+	for id, raw := range effects.Effects {
+		def := base.Effects[id]
+		if err := json.Unmarshal(raw, &def); err != nil {
+			return nil, fmt.Errorf("parsing tuning file %s: effect %s: %w", path, id, err)
+		}
+		t.Effects[id] = def
+	}
+	var items struct {
+		Items map[ItemID]json.RawMessage `json:"items"`
+	}
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, fmt.Errorf("parsing tuning file %s: %w", path, err)
+	}
+	for id, raw := range items.Items {
+		def := base.Items[id]
+		def.Cures = slices.Clone(def.Cures)
+		def.Resistances = maps.Clone(def.Resistances)
+		if err := json.Unmarshal(raw, &def); err != nil {
+			return nil, fmt.Errorf("parsing tuning file %s: item %s: %w", path, id, err)
+		}
+		t.Items[id] = def
+	}
+	if err := t.Validate(); err != nil {
+		return nil, fmt.Errorf("tuning file %s: %w", path, err)
+	}
+	return t, nil
+}
+
+func (t *Tuning) Validate() error {
+	if len(t.XPThresholds) == 0 {
+		return fmt.Errorf("xp_thresholds must not be empty")
+	}
+	for level, xp := range t.XPThresholds {
+		if level < 1 || xp <= 0 {
+			return fmt.Errorf("invalid xp threshold %d for level %d", xp, level)
+		}
+	}
+	levels := slices.Sorted(maps.Keys(t.XPThresholds))
+	for i := 1; i < len(levels); i++ {
+		if t.XPThresholds[levels[i]] < t.XPThresholds[levels[i-1]] {
+			return fmt.Errorf("xp threshold for level %d must not be below that for level %d", levels[i], levels[i-1])
+		}
+	}
+	if t.XPStep <= 0 {
+		return fmt.Errorf("xp_step must be positive, got %d", t.XPStep)
+	}
+	if err := validateMonsters(t.Monsters); err != nil {
+		return err
+	}
+	if t.DepthScaling < 0 {
+		return fmt.Errorf("depth_scaling must not be negative, got %v", t.DepthScaling)
+	}
+	if t.FleeBaseChance < 0 || t.FleeBaseChance > 1 || t.FleeChancePerPoint < 0 {
+		return fmt.Errorf("flee_base_chance must be between 0 and 1 and flee_chance_per_point not negative")
+	}
+	if t.HitChance < 0 || t.HitChance > 1 || t.CritChance < 0 || t.CritChance > 1 {
+		return fmt.Errorf("hit_chance and crit_chance must be between 0 and 1")
+	}
+	if t.CritMultiplier < 1 {
+		return fmt.Errorf("crit_multiplier must be at least 1, got %v", t.CritMultiplier)
+	}
+	if t.DamageVariance < 0 || t.DamageVariance > 1 {
+		return fmt.Errorf("damage_variance must be between 0 and 1, got %v", t.DamageVariance)
+	}
+	if t.ElementalPower < 0 {
+		return fmt.Errorf("elemental_power must not be negative, got %v", t.ElementalPower)
+	}
+	if t.ElementalDefense < 0 || t.ElementalDefense > 1 {
+		return fmt.Errorf("elemental_defense must be between 0 and 1, got %v", t.ElementalDefense)
+	}
+	for id, def := range t.Effects {
+		if err := def.validate(); err != nil {
+			return fmt.Errorf("effect %s: %w", id, err)
+		}
+	}
+	for id, def := range t.Items {
+		if err := def.validate(t.Effects); err != nil {
+			return fmt.Errorf("item %s: %w", id, err)
+		}
+	}
+	if t.InventorySlots <= 0 {
+		return fmt.Errorf("inventory_slots must be positive, got %d", t.InventorySlots)
+	}
+	for _, stack := range t.StartingItems {
+		if _, ok := t.Items[stack.Item]; !ok || stack.Count <= 0 {
+			return fmt.Errorf("starting_items: unknown item %q or count not positive", stack.Item)
+		}
+	}
+	if t.LootDespawnMs <= 0 {
+		return fmt.Errorf("loot_despawn_ms must be positive, got %d", t.LootDespawnMs)
+	}
+	// Monster tables are validated on their own, before the effects and items are known.
+	for mType, stats := range t.Monsters {
+		for _, onHit := range stats.OnHit {
+			if _, ok := t.Effects[onHit.Effect]; !ok {
+				return fmt.Errorf("monster %s: unknown on_hit effect %q", mType, onHit.Effect)
+			}
+		}
+		if err := stats.Loot.validate(t.Items); err != nil {
+			return fmt.Errorf("monster %s: %w", mType, err)
+		}
+	}
+	return nil
+}
+
+func validateMonsters(monsters map[protocol.MonsterType]MonsterStats) error {
+	surfaceWeight := 0
+	for mType, stats := range monsters {
+		if stats.MaxHP <= 0 || stats.Attack < 0 || stats.Defense < 0 || stats.XPValue < 0 {
+			return fmt.Errorf("invalid stats for monster %s", mType)
+		}
+		if utf8.RuneCountInString(stats.Glyph) != 1 {
+			return fmt.Errorf("monster %s: glyph must be a single character, got %q", mType, stats.Glyph)
+		}
+		if _, ok := stats.RGBA(); stats.Color != "" && !ok {
+			return fmt.Errorf("monster %s: color must look like #rrggbb, got %q", mType, stats.Color)
+		}
+		// The glyph doubles as the archetype's spawn marker on ASCII maps.
+		glyph, _ := utf8.DecodeRuneInString(stats.Glyph)
+		if _, isTile := TileTypeByGlyph(glyph); isTile || glyph == '@' {
+			return fmt.Errorf("monster %s: glyph %q is already used for a tile or the player spawn", mType, glyph)
+		}
+		switch stats.Behaviour {
+		case BehaviourHunt, BehaviourWander, BehaviourGuard:
+		default:
+			return fmt.Errorf("monster %s: unknown behaviour %q", mType, stats.Behaviour)
+		}
+		if stats.AggroRadius < 0 || stats.GiveUpDistance < stats.AggroRadius {
+			return fmt.Errorf("monster %s: give_up_distance must be at least aggro_radius, which must not be negative", mType)
+		}
+		if stats.SpawnWeight < 0 || stats.MinDepth < 0 {
+			return fmt.Errorf("monster %s: spawn_weight and min_depth must not be negative", mType)
+		}
+		if stats.DamageType != "" && !stats.DamageType.Valid() {
+			return fmt.Errorf("monster %s: unknown damage_type %q", mType, stats.DamageType)
+		}
+		if err := stats.Resistances.validate(); err != nil {
+			return fmt.Errorf("monster %s: %w", mType, err)
+		}
+		for _, onHit := range stats.OnHit {
+			if onHit.Chance < 0 || onHit.Chance > 1 {
+				return fmt.Errorf("monster %s: on_hit chance for %s must be between 0 and 1", mType, onHit.Effect)
+			}
+		}
+		if stats.MinDepth == 0 {
+			surfaceWeight += stats.SpawnWeight
+		}
+	}
+	// Every floor has to be able to spawn something.
+	if surfaceWeight == 0 {
+		return fmt.Errorf("at least one monster with min_depth 0 needs a positive spawn_weight")
+	}
+	return nil
+}
+
+func (t *Tuning) clone() *Tuning {
+	c := *t
+	c.XPThresholds = make(map[int]int, len(t.XPThresholds))
+	for k, v := range t.XPThresholds {
+		c.XPThresholds[k] = v
+	}
+	c.Monsters = make(map[protocol.MonsterType]MonsterStats, len(t.Monsters))
+	for k, v := range t.Monsters {
+		c.Monsters[k] = v
+	}
+	c.Effects = maps.Clone(t.Effects)
+	c.Items = maps.Clone(t.Items)
+	return &c
+}
+
+// XPToNextLevel looks level up in XPThresholds. A level missing from the table
+// grows by XPStep per level from the closest configured level below it, or uses the
+// lowest configured level when there is none below.
+func (t *Tuning) XPToNextLevel(level int) int {
+	if nextXP, ok := t.XPThresholds[level]; ok {
+		return nextXP
+	}
+
+	below, lowest := 0, 0
+	for l := range t.XPThresholds {
+		if l < level && l > below {
+			below = l
+		}
+		if lowest == 0 || l < lowest {
+			lowest = l
+		}
+	}
+	if below == 0 {
+		return t.XPThresholds[lowest]
+	}
+	return t.XPThresholds[below] + (level-below)*t.XPStep
+}
+
+// RGBA parses Color.
+func (s MonsterStats) RGBA() (color.RGBA, bool) {
+	var c color.RGBA
+	if len(s.Color) != 7 {
+		return c, false
+	}
+	if _, err := fmt.Sscanf(s.Color, "#%02x%02x%02x", &c.R, &c.G, &c.B); err != nil {
+		return c, false
+	}
+	c.A = 0xff
+	return c, true
+}
+
+// MonsterStats returns the stats of mType scaled for a floor at depth.
+func (t *Tuning) MonsterStats(mType protocol.MonsterType, depth int) MonsterStats {
+	stats, ok := t.Monsters[mType]
+	if !ok {
+		stats = fallbackMonsterStats
+	}
+	return stats.atDepth(depth, t.DepthScaling)
+}
+
+func (s MonsterStats) atDepth(depth int, scaling float64) MonsterStats {
+	if depth <= 0 || scaling == 0 {
+		return s
+	}
+	mult := 1 + scaling*float64(depth)
+	s.MaxHP = int(float64(s.MaxHP)*mult + 0.5)
+	s.Attack = int(float64(s.Attack)*mult + 0.5)
+	s.Defense = int(float64(s.Defense)*mult + 0.5)
+	s.XPValue = int(float64(s.XPValue)*mult + 0.5)
+	return s
+}
+
+// pickMonsterType chooses a monster type that may appear at depth, according to
+// the spawn weights.
+func (t *Tuning) pickMonsterType(r *rand.Rand, depth int) protocol.MonsterType {
+	types := make([]protocol.MonsterType, 0, len(t.Monsters))
+	total := 0
+	for mType, stats := range t.Monsters {
+		if stats.MinDepth > depth || stats.SpawnWeight == 0 {
+			continue
+		}
+		types = append(types, mType)
+		total += stats.SpawnWeight
+	}
+	// Sort so the same random number always picks the same type.
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+
+	roll := r.Intn(total)
+	for _, mType := range types {
+		roll -= t.Monsters[mType].SpawnWeight
+		if roll < 0 {
+			return mType
+		}
+	}
+	return types[len(types)-1]
+}
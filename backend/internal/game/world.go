@@ -7,6 +7,7 @@ import (
 	"log"
 	"math/rand"
 	"sync"
+	"time"
 )
 
 type Tile struct {
@@ -26,96 +27,204 @@ type World struct {
 	Players  map[string]*Player
 	Mu       sync.Mutex
 	hub      HubBroadcaster
+
+	// occupied mirrors the positions in Monsters and Players. Anything that adds,
+	// removes or moves an entity has to go through it.
+	occupied occupancy
+
+	// Simulation clock, advanced by Step. Tick counts the steps taken so far and
+	// TickRate is how many Run takes per second.
+	Tick         uint64
+	TickRate     int
+	timers       timerQueue
+	timerSeq     uint64
+	monsterOrder []*Monster
+
+	// population is what Populate was last asked to maintain; monsterSeq numbers
+	// the monsters it spawns.
+	population Population
+	monsterSeq int
+
+	// combats holds the fights in progress, keyed by monster ID. CombatTimeout ends
+	// those in which nobody has acted for that long; zero never times out.
+	combats       map[string]*CombatSession
+	CombatTimeout time.Duration
+	// resolver rolls every attack. It gets its own random source derived from Seed
+	// so the number of fights doesn't change the monster layout.
+	resolver CombatResolver
+
+	// groundItems are the items lying on the floor, keyed by ID; groundItemSeq
+	// numbers them.
+	groundItems   map[string]*GroundItem
+	groundItemSeq int
+
+	// Tuning is swapped as a whole by ApplyTuning; read it with Mu held.
+	Tuning *Tuning
+
+	// Depth is this world's floor in its Dungeon, 0 being the top.
+	Depth int
+
+	// Seed reproduces the map and monster layout. rng is derived from it and, like
+	// everything else on World, is only used with Mu held.
+	Seed int64
+	rng  *rand.Rand
+
+	// reachable marks the tiles of the largest connected walkable region.
+	reachable      []bool
+	reachableTiles []Point
+
+	// Spawn markers and named regions from a hand-authored map. Empty for
+	// generated maps.
+	PlayerSpawns  []Point
+	MonsterSpawns []MonsterSpawn
+	Regions       []Region
 }
 
 func (w *World) SetHubBroadcaster(broadcaster HubBroadcaster) {
 	w.hub = broadcaster
 }
 
-func NewWorld(width, height int) *World {
-	tiles := make([][]Tile, height)
-	for y := 0; y < height; y++ {
-		tiles[y] = make([]Tile, width)
-		for x := 0; x < width; x++ {
-			tileType := protocol.Grass
-
-			if rand.Intn(100) < 20 {
-				tileType = protocol.Stone
-			}
+// NewWorld generates a map with gen, or the default scatter generator when gen is nil.
+func NewWorld(width, height int, seed int64, gen MapGenerator) *World {
+	rng := rand.New(rand.NewSource(seed))
 
-			if x == 0 || y == 0 || x == width-1 || y == height-1 {
-				tileType = protocol.Stone
-			}
-			tiles[y][x] = Tile{Type: tileType, X: x, Y: y}
-		}
+	if gen == nil {
+		gen, _ = NewMapGenerator("")
 	}
+	tiles := gen.Generate(width, height, rng)
 
-	world := &World{
-		Width:    width,
-		Height:   height,
+	world := newWorldFromTiles(tiles, seed)
+	world.rng = rng
+	world.RepairConnectivity(minConnectedRegionSize)
+	return world
+}
+
+func newWorldFromTiles(tiles [][]Tile, seed int64) *World {
+	return &World{
+		Width:    len(tiles[0]),
+		Height:   len(tiles),
 		Tiles:    tiles,
 		Monsters: make(map[string]*Monster),
 		Players:  make(map[string]*Player),
 		hub:      nil,
+		occupied: newOccupancy(len(tiles[0]), len(tiles)),
+		TickRate: DefaultTickRate,
+
+		combats:       make(map[string]*CombatSession),
+		CombatTimeout: DefaultCombatTimeout,
+		Tuning:        DefaultTuning(),
+		Seed:          seed,
+		rng:           rand.New(rand.NewSource(seed)),
+		resolver:      NewStandardResolver(rand.New(rand.NewSource(seed + 1))),
+		groundItems:   make(map[string]*GroundItem),
 	}
-	return world
+}
+
+// ApplyTuning swaps in new gameplay values. Live monsters pick up their new stat
+// block and players get their XP requirement for the current level recalculated,
+// levelling up straight away if they already have enough XP.
+func (w *World) ApplyTuning(t *Tuning) {
+	w.Mu.Lock()
+	defer w.Mu.Unlock()
+
+	w.Tuning = t
+	for _, m := range w.Monsters {
+		if _, ok := t.Monsters[m.Type]; ok {
+			m.applyStats(t.MonsterStats(m.Type, w.Depth))
+		}
+	}
+	for _, p := range w.Players {
+		oldXPToNextLevel := p.XPToNextLevel
+		p.XPToNextLevel = t.XPToNextLevel(p.Level)
+		// A lower threshold can leave a player with enough XP for the next level.
+		if p.applyLevelUps(t) || p.XPToNextLevel != oldXPToNextLevel {
+			w.broadcastInternal(protocol.S2C_MessageTypePlayerStatUpdate, p.StatUpdatePayload())
+		}
+	}
+	log.Printf("Tuning applied to world: %d monsters and %d players updated.", len(w.Monsters), len(w.Players))
 }
 
 func (w *World) AddMonster(m *Monster) {
 	w.Mu.Lock()
-	w.Monsters[m.GetID()] = m
+	w.addMonsterInternal(m)
 	w.Mu.Unlock()
+}
+
+// addMonsterInternal also gives the monster its AI schedule: a first move after
+// 0.25s to 1s and then one every 0.25s to 1s.
+// Assumes w.Mu is HELD
+func (w *World) addMonsterInternal(m *Monster) {
+	w.Monsters[m.GetID()] = m
+	w.occupied.addMonster(m)
+	w.addToMonsterOrder(m)
 
-	go m.RunAI(w)
+	initialDelay := time.Duration(w.rng.Intn(750)+250) * time.Millisecond
+	tickInterval := time.Duration(w.rng.Intn(750)+250) * time.Millisecond
+	m.nextActTick = w.Tick + w.TicksFor(initialDelay)
+	m.actEvery = w.TicksFor(tickInterval)
 }
 
 func (w *World) RemoveMonster(MonsterID string) {
 	w.Mu.Lock()
 	defer w.Mu.Unlock()
+	w.RemoveMonsterInternal(MonsterID)
+}
 
+// Assumes w.Mu is HELD
+func (w *World) RemoveMonsterInternal(MonsterID string) {
 	if monster, ok := w.Monsters[MonsterID]; ok {
-		if monster.stopAI != nil {
-			close(monster.stopAI)
+		if session := w.CombatSessionInternal(monster); session != nil {
+			w.EndCombatInternal(session, CombatEndMonsterRemoved)
 		}
 		delete(w.Monsters, MonsterID)
+		w.occupied.removeMonster(monster)
+		w.removeFromMonsterOrder(monster)
 		fmt.Printf("Monster %s removed.\n", MonsterID)
+		if monster.slot != nil {
+			w.scheduleRespawnInternal(monster.slot)
+		}
 	}
 }
 
-func (w *World) SpawnInitialMonsters(count int) {
-	for i := 0; i < count; i++ {
-		fmt.Print(i)
-		id := fmt.Sprintf("monster-%03d", i)
-		var mType protocol.MonsterType
-		if rand.Intn(2) == 0 {
-			mType = protocol.Goblin
-		} else {
-			mType = protocol.Orc
-		}
-
-		var spawnX, spawnY int
-		for {
-			spawnX = rand.Intn(w.Width)
-			spawnY = rand.Intn(w.Height)
-			if w.IsWalkable(spawnX, spawnY) && w.GetMonsterAt(spawnX, spawnY) == nil {
-				break
+// FindPlayerSpawnInternal picks a free player spawn marker if the map has any, and
+// otherwise a free tile in the largest connected region. ok is false when there is
+// no free tile left.
+// Assumes w.Mu is HELD
+func (w *World) FindPlayerSpawnInternal() (x, y int, ok bool) {
+	if n := len(w.PlayerSpawns); n > 0 {
+		start := w.rng.Intn(n)
+		for i := 0; i < n; i++ {
+			p := w.PlayerSpawns[(start+i)%n]
+			if !w.IsOccupiedInternal(p.X, p.Y) {
+				return p.X, p.Y, true
 			}
 		}
-		monster := NewMonster(id, mType, spawnX, spawnY)
-		w.AddMonster(monster)
 	}
+	return w.findFreeReachableTile()
 }
 
 func (w *World) AddPlayer(p *Player) {
 	w.Players[p.GetID()] = p
+	w.occupied.addPlayer(p)
 }
 
 func (w *World) RemovePlayer(playerID string) {
 	w.Mu.Lock()
-	delete(w.Players, playerID)
+	w.removePlayerInternal(playerID)
 	w.Mu.Unlock()
 }
 
+// Assumes w.Mu is HELD
+func (w *World) removePlayerInternal(playerID string) {
+	if p, ok := w.Players[playerID]; ok {
+		if session := w.playerCombatInternal(p); session != nil {
+			w.LeaveCombatInternal(session, p, CombatEndPlayerLeft)
+		}
+		delete(w.Players, playerID)
+		w.occupied.removePlayer(p)
+	}
+}
+
 func (w *World) GetPlayer(playerID string) *Player {
 	w.Mu.Lock()
 	defer w.Mu.Unlock()
@@ -130,22 +239,12 @@ func (w *World) GetMonster(monsterID string) *Monster {
 
 func (w *World) getMonsterAtInternal(x, y int) *Monster {
 	// Assumes w.Mu is HELD
-	for _, m := range w.Monsters {
-		if m.GetX() == x && m.GetY() == y {
-			return m
-		}
-	}
-	return nil
+	return w.occupied.monsterAt(x, y)
 }
 
 func (w *World) getPlayerAtInternal(x, y int) *Player {
 	// Assumes w.Mu is HELD
-	for _, p := range w.Players {
-		if p.GetX() == x && p.GetY() == y {
-			return p
-		}
-	}
-	return nil
+	return w.occupied.playerAt(x, y)
 }
 
 // IsOccupiedInternal assumes w.Mu is HELD by caller
@@ -162,23 +261,13 @@ func (w *World) IsOccupiedInternal(x, y int) bool {
 func (w *World) GetMonsterAt(x, y int) *Monster {
 	w.Mu.Lock()
 	defer w.Mu.Unlock()
-	for _, m := range w.Monsters {
-		if m.GetX() == x && m.GetY() == y {
-			return m
-		}
-	}
-	return nil
+	return w.getMonsterAtInternal(x, y)
 }
 
 func (w *World) GetPlayerAt(x, y int) *Player {
 	w.Mu.Lock()
 	defer w.Mu.Unlock()
-	for _, p := range w.Players {
-		if p.GetX() == x && p.GetY() == y {
-			return p
-		}
-	}
-	return nil
+	return w.getPlayerAtInternal(x, y)
 }
 
 func (w *World) IsOccupied(x, y int) bool {
@@ -203,7 +292,7 @@ func (w *World) IsWalkable(x, y int) bool {
 	if tile == nil {
 		return false // out of bounds
 	}
-	return tile.Type == protocol.Grass
+	return TileProps(tile.Type).Passable
 }
 
 func (w *World) String() string {
@@ -214,30 +303,15 @@ func (w *World) String() string {
 	for y := 0; y < w.Height; y++ {
 		grid[y] = make([]rune, w.Width)
 		for x := 0; x < w.Width; x++ {
-			tile := w.Tiles[y][x]
-			switch tile.Type {
-			case protocol.Grass:
-				grid[y][x] = '.'
-			case protocol.Stone:
-				grid[y][x] = '#'
-			default:
-				grid[y][x] = '?'
-			}
+			grid[y][x] = TileProps(w.Tiles[y][x].Type).Glyph
 		}
 	}
 
 	for _, monster := range w.Monsters {
 		mx, my := monster.GetX(), monster.GetY()
 		if my >= 0 && my < w.Height && mx >= 0 && mx < w.Width {
-			if w.Tiles[my][mx].Type == protocol.Grass {
-				switch monster.Type {
-				case protocol.Goblin:
-					grid[my][mx] = 'g'
-				case protocol.Orc:
-					grid[my][mx] = 'O'
-				default:
-					grid[my][mx] = 'M'
-				}
+			if w.IsWalkable(mx, my) {
+				grid[my][mx] = monster.GlyphRune()
 			}
 		}
 	}
@@ -245,7 +319,7 @@ func (w *World) String() string {
 	for _, player := range w.Players {
 		px, py := player.GetX(), player.GetY()
 		if py >= 0 && py < w.Height && px >= 0 && px < w.Width {
-			if w.Tiles[py][px].Type == protocol.Grass {
+			if w.IsWalkable(px, py) {
 				grid[py][px] = '@'
 			}
 		}
@@ -260,23 +334,19 @@ func (w *World) String() string {
 }
 
 func (w *World) MoveMonster(m *Monster, newX, newY int) bool {
-	if !w.IsWalkable(newX, newY) {
+	// Monsters know better than to walk into lava.
+	if !w.isSafeSpawn(newX, newY) {
 		return false
 	}
 
-	for _, otherMonster := range w.Monsters {
-		if otherMonster.GetID() != m.GetID() && otherMonster.GetX() == newX && otherMonster.GetY() == newY {
-			return false
-		}
+	if other := w.getMonsterAtInternal(newX, newY); other != nil && other != m {
+		return false
 	}
-	for _, player := range w.Players {
-		if player.GetX() == newX && player.GetY() == newY {
-			return false
-		}
+	if w.getPlayerAtInternal(newX, newY) != nil {
+		return false
 	}
 
-	m.X = newX
-	m.Y = newY
+	w.occupied.moveMonster(m, newX, newY)
 
 	if w.hub != nil {
 		movedPayload := protocol.S2C_EntityMovedPayload{
@@ -0,0 +1,106 @@
+// Package mapimage renders a game.World to an image for map review and bug reports.
+package mapimage
+
+import (
+	"game-server/internal/game"
+	"game-server/internal/protocol"
+	"hash/fnv"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+)
+
+type Options struct {
+	TileSize int  // pixels per tile; defaults to 16
+	Grid     bool // draw a one pixel line between tiles
+}
+
+var (
+	tileColors = map[protocol.TileType]color.RGBA{
+		protocol.Grass:  {R: 0x90, G: 0xee, B: 0x90, A: 0xff},
+		protocol.Stone:  {R: 0x80, G: 0x80, B: 0x80, A: 0xff},
+		protocol.Water:  {R: 0x42, G: 0x87, B: 0xf5, A: 0xff},
+		protocol.Lava:   {R: 0xff, G: 0x6a, B: 0x00, A: 0xff},
+		protocol.Door:   {R: 0x8b, G: 0x5a, B: 0x2b, A: 0xff},
+		protocol.Bridge: {R: 0xc8, G: 0xa0, B: 0x6e, A: 0xff},
+		protocol.Rubble: {R: 0xa8, G: 0xa0, B: 0x8a, A: 0xff},
+
+		protocol.StairsDown: {R: 0x4a, G: 0x35, B: 0x6e, A: 0xff},
+		protocol.StairsUp:   {R: 0xd8, G: 0xc8, B: 0xf0, A: 0xff},
+	}
+	unknownTileColor = color.RGBA{R: 0xff, G: 0x00, B: 0xff, A: 0xff}
+	playerColor      = color.RGBA{R: 0x00, G: 0x00, B: 0xff, A: 0xff}
+	gridColor        = color.RGBA{R: 0x00, G: 0x00, B: 0x00, A: 0x40}
+)
+
+// Render draws the tiles, monsters and players of w. It takes w.Mu for the
+// duration of the call.
+func Render(w *game.World, opts Options) *image.RGBA {
+	size := opts.TileSize
+	if size <= 0 {
+		size = 16
+	}
+
+	w.Mu.Lock()
+	defer w.Mu.Unlock()
+
+	img := image.NewRGBA(image.Rect(0, 0, w.Width*size, w.Height*size))
+	for y := 0; y < w.Height; y++ {
+		for x := 0; x < w.Width; x++ {
+			c, ok := tileColors[w.Tiles[y][x].Type]
+			if !ok {
+				c = unknownTileColor
+			}
+			fillTile(img, x, y, size, 0, c)
+		}
+	}
+
+	// Entities are drawn inset so the tile underneath stays visible.
+	inset := size / 5
+	for _, m := range w.Monsters {
+		fillTile(img, m.GetX(), m.GetY(), size, inset, monsterColor(w.Tuning, m.Type))
+	}
+	for _, p := range w.Players {
+		fillTile(img, p.GetX(), p.GetY(), size, inset, playerColor)
+	}
+
+	if opts.Grid && size > 2 {
+		drawGrid(img, w.Width, w.Height, size)
+	}
+	return img
+}
+
+// monsterColor is the archetype's configured colour, or one derived from its name
+// so that archetypes without one still tell apart.
+func monsterColor(t *game.Tuning, mType protocol.MonsterType) color.RGBA {
+	if c, ok := t.Monsters[mType].RGBA(); ok {
+		return c
+	}
+	h := fnv.New32a()
+	h.Write([]byte(mType))
+	sum := h.Sum32()
+	// Keep every channel in the middle range so the marker stands out on any tile.
+	return color.RGBA{R: 0x40 + uint8(sum)%0x90, G: 0x40 + uint8(sum>>8)%0x90, B: 0x40 + uint8(sum>>16)%0x90, A: 0xff}
+}
+
+// Encode renders w and writes it to out as a PNG.
+func Encode(out io.Writer, w *game.World, opts Options) error {
+	return png.Encode(out, Render(w, opts))
+}
+
+func fillTile(img *image.RGBA, x, y, size, inset int, c color.RGBA) {
+	r := image.Rect(x*size+inset, y*size+inset, (x+1)*size-inset, (y+1)*size-inset)
+	draw.Draw(img, r, &image.Uniform{C: c}, image.Point{}, draw.Src)
+}
+
+func drawGrid(img *image.RGBA, width, height, size int) {
+	line := &image.Uniform{C: gridColor}
+	for x := 1; x < width; x++ {
+		draw.Draw(img, image.Rect(x*size, 0, x*size+1, height*size), line, image.Point{}, draw.Over)
+	}
+	for y := 1; y < height; y++ {
+		draw.Draw(img, image.Rect(0, y*size, width*size, y*size+1), line, image.Point{}, draw.Over)
+	}
+}
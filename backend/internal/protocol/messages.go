@@ -16,14 +16,51 @@ type C2S_MovePayload struct {
 
 type C2S_AttackPayload struct {
 	TargetID string `json:"target_id"`
+	// DamageType comes from the player's weapon. If set, it must match it or the
+	// attack is refused.
+	DamageType string `json:"damage_type,omitempty"`
 }
 
 type C2S_UsePotionPayload struct {
 }
 
+// Items are addressed by inventory slot, counting from 0.
+type C2S_UseItemPayload struct {
+	Slot int `json:"slot"`
+}
+
+// C2S_DropItemPayload drops Count items from Slot; 0 drops the whole stack.
+type C2S_DropItemPayload struct {
+	Slot  int `json:"slot"`
+	Count int `json:"count"`
+}
+
+type C2S_InspectItemPayload struct {
+	Slot int `json:"slot"`
+}
+
+// C2S_PickupPayload picks up the items on the player's tile. Walking onto a tile
+// does the same.
+type C2S_PickupPayload struct{}
+
+// C2S_EquipPayload wears the item in inventory slot Slot.
+type C2S_EquipPayload struct {
+	Slot int `json:"slot"`
+}
+
+// C2S_UnequipPayload takes off the item worn in equipment slot Slot, such as "weapon".
+type C2S_UnequipPayload struct {
+	Slot string `json:"slot"`
+}
+
 // --- Server-to-Client (S2C) Message Payloads ---
 type S2C_TileData struct {
-	Type TileType `json:"type"`
+	Type          TileType `json:"type"`
+	Name          string   `json:"name"`
+	Passable      bool     `json:"passable"`
+	BlocksSight   bool     `json:"blocks_sight"`
+	MoveCost      int      `json:"move_cost"`
+	DamagePerStep int      `json:"damage_per_step"`
 }
 
 // S2C_MapData represents the entire map structure.
@@ -50,16 +87,78 @@ type S2C_MonsterData struct {
 	Y         int         `json:"y"`
 	Type      MonsterType `json:"type"`
 	Name      string      `json:"name"`
+	Glyph     string      `json:"glyph"`
 	MaxHP     int         `json:"max_hp"`
 	CurrentHP int         `json:"current_hp"`
 }
 
 // S2C_InitialStatePayload is sent to a client upon successful connection.
 type S2C_InitialStatePayload struct {
-	PlayerID string            `json:"player_id"`
-	Map      S2C_MapData       `json:"map"`
-	Players  []S2C_PlayerData  `json:"players"`
-	Monsters []S2C_MonsterData `json:"monsters"`
+	PlayerID string `json:"player_id"`
+	Seed     int64  `json:"seed,string"` // string so JS clients keep all 64 bits
+	// Floor is the depth of the floor this state describes, 0 being the top.
+	Floor      int               `json:"floor"`
+	FloorCount int               `json:"floor_count"`
+	Map        S2C_MapData       `json:"map"`
+	Players    []S2C_PlayerData  `json:"players"`
+	Monsters   []S2C_MonsterData `json:"monsters"`
+	// Inventory is the receiving player's own.
+	Inventory   S2C_InventoryData    `json:"inventory"`
+	GroundItems []S2C_GroundItemData `json:"ground_items"`
+}
+
+// S2C_GroundItemData is a stack of items lying on the floor. It is the payload of
+// ground_item_added, which is sent again with the new Count when part of a stack
+// is picked up.
+type S2C_GroundItemData struct {
+	ID     string `json:"id"`
+	X      int    `json:"x"`
+	Y      int    `json:"y"`
+	ItemID string `json:"item_id"`
+	Name   string `json:"name"`
+	Kind   string `json:"kind"`
+	Count  int    `json:"count"`
+}
+
+// S2C_GroundItemRemovedPayload is sent when a ground item is picked up or despawns.
+type S2C_GroundItemRemovedPayload struct {
+	ID string `json:"id"`
+}
+
+// S2C_InventorySlotData is one inventory slot. A Count of 0 means the slot is empty.
+type S2C_InventorySlotData struct {
+	Slot   int    `json:"slot"`
+	ItemID string `json:"item_id,omitempty"`
+	Name   string `json:"name,omitempty"`
+	Kind   string `json:"kind,omitempty"`
+	Count  int    `json:"count"`
+}
+
+// S2C_InventoryData lists the occupied slots out of Capacity.
+type S2C_InventoryData struct {
+	Capacity int                     `json:"capacity"`
+	Slots    []S2C_InventorySlotData `json:"slots"`
+}
+
+// S2C_InventoryUpdatePayload is sent to a player whenever slots of their inventory
+// change, with the new content of just those slots.
+type S2C_InventoryUpdatePayload struct {
+	Slots []S2C_InventorySlotData `json:"slots"`
+}
+
+// S2C_ItemInfoPayload answers inspect_item.
+type S2C_ItemInfoPayload struct {
+	S2C_InventorySlotData
+	Description string   `json:"description"`
+	MaxStack    int      `json:"max_stack"`
+	Heal        int      `json:"heal,omitempty"`
+	Effect      string   `json:"effect,omitempty"`
+	Cures       []string `json:"cures,omitempty"`
+
+	AttackMod   int                `json:"attack_mod,omitempty"`
+	DefenseMod  int                `json:"defense_mod,omitempty"`
+	Resistances map[string]float64 `json:"resistances,omitempty"`
+	DamageType  string             `json:"damage_type,omitempty"`
 }
 
 // S2C_PlayerJoinedPayload is broadcast when a new player joins.
@@ -100,6 +199,11 @@ type S2C_CombatInitiatedPayload struct {
 
 	MonsterX int `json:"monster_x"`
 	MonsterY int `json:"monster_y"`
+
+	// AttackerIDs lists everyone now fighting the monster, PlayerID included, and
+	// MonsterTargetID the one it is hitting back.
+	AttackerIDs     []string `json:"attacker_ids"`
+	MonsterTargetID string   `json:"monster_target_id"`
 }
 
 type S2C_CombatUpdatePayload struct {
@@ -108,6 +212,67 @@ type S2C_CombatUpdatePayload struct {
 	DamageDealt        int    `json:"damage_dealt"`
 	DefenderCurrentHP  int    `json:"defender_current_hp"`
 	IsDefenderDefeated bool   `json:"is_defender_defeated"`
+	// Missed attacks deal no damage; Critical ones deal extra.
+	Missed   bool `json:"missed"`
+	Critical bool `json:"critical"`
+	// Effectiveness is immune, resisted, normal or weak, after the defender's
+	// resistance to DamageType.
+	DamageType    string `json:"damage_type"`
+	Effectiveness string `json:"effectiveness"`
+}
+
+// S2C_FleeResultPayload is broadcast after a player tries to flee. Escaped players
+// are at X, Y; otherwise DamageTaken is the monster's parting attack.
+type S2C_FleeResultPayload struct {
+	PlayerID        string  `json:"player_id"`
+	MonsterID       string  `json:"monster_id"`
+	Escaped         bool    `json:"escaped"`
+	Chance          float64 `json:"chance"`
+	DamageTaken     int     `json:"damage_taken"`
+	PlayerCurrentHP int     `json:"player_current_hp"`
+	X               int     `json:"x"`
+	Y               int     `json:"y"`
+}
+
+// S2C_CombatEndedPayload is broadcast whenever a player's fight is over, whatever the
+// cause.
+// Reason is one of monster_defeated, player_defeated, player_left, monster_removed,
+// timeout or fled. It is sent once per player taking part, and MonsterTargetID is
+// who the monster turns to next, empty once nobody is left fighting it.
+type S2C_CombatEndedPayload struct {
+	PlayerID        string `json:"player_id"`
+	MonsterID       string `json:"monster_id"`
+	Reason          string `json:"reason"`
+	MonsterTargetID string `json:"monster_target_id"`
+}
+
+// S2C_EffectAppliedPayload is broadcast when a status effect is put on a player or
+// monster, or stacked or refreshed. DurationMs counts from now.
+type S2C_EffectAppliedPayload struct {
+	EntityID   string `json:"entity_id"`
+	EntityType string `json:"entity_type"`
+	EffectID   string `json:"effect_id"`
+	Name       string `json:"name"`
+	SourceID   string `json:"source_id,omitempty"`
+	Stacks     int    `json:"stacks"`
+	DurationMs int    `json:"duration_ms"`
+}
+
+type S2C_EffectExpiredPayload struct {
+	EntityID   string `json:"entity_id"`
+	EntityType string `json:"entity_type"`
+	EffectID   string `json:"effect_id"`
+}
+
+// S2C_EffectTickPayload reports damage or healing over time.
+type S2C_EffectTickPayload struct {
+	EntityID   string `json:"entity_id"`
+	EntityType string `json:"entity_type"`
+	EffectID   string `json:"effect_id"`
+	Damage     int    `json:"damage"`
+	Healing    int    `json:"healing"`
+	CurrentHP  int    `json:"current_hp"`
+	IsDefeated bool   `json:"is_defeated"`
 }
 
 type S2C_PlayerStatUpdatePayload struct {
@@ -117,8 +282,25 @@ type S2C_PlayerStatUpdatePayload struct {
 	XPToNextLevel int    `json:"xp_to_next_level"`
 	MaxHP         int    `json:"max_hp"`
 	CurrentHP     int    `json:"current_hp"`
-	Attack        int    `json:"attack"`
-	Defense       int    `json:"defense"`
+	// Attack and Defense are the player's base stats. The effective ones add
+	// equipment and status effects and are what combat uses.
+	Attack           int `json:"attack"`
+	Defense          int `json:"defense"`
+	EffectiveAttack  int `json:"effective_attack"`
+	EffectiveDefense int `json:"effective_defense"`
+	// DamageType is what the player's attacks deal, set by their weapon.
+	DamageType string                 `json:"damage_type"`
+	Equipment  []S2C_EquippedItemData `json:"equipment"`
+}
+
+// S2C_EquippedItemData is an item worn in the equipment slot Slot.
+type S2C_EquippedItemData struct {
+	Slot       string `json:"slot"`
+	ItemID     string `json:"item_id"`
+	Name       string `json:"name"`
+	AttackMod  int    `json:"attack_mod,omitempty"`
+	DefenseMod int    `json:"defense_mod,omitempty"`
+	DamageType string `json:"damage_type,omitempty"`
 }
 
 type S2C_NotificationPayload struct {
@@ -131,19 +313,35 @@ type S2C_NotificationPayload struct {
 const (
 	C2S_MessageTypeMove   = "move"
 	C2S_MessageTypeAttack = "attack"
+	C2S_MessageTypeFlee   = "flee"
 )
 
 // S2C (Server to Client) Message Types
 const (
-	S2C_MessageTypeInitialState     = "initial_state"
-	S2C_MessageTypePlayerJoined     = "player_joined"
-	S2C_MessageTypePlayerLeft       = "player_left"
-	S2C_MessageTypeEntityMoved      = "entity_moved"
-	S2C_MessageTypeMonsterSpawned   = "monster_spawned"
-	S2C_MessageTypeEntityRemoved    = "entity_removed"
-	S2C_MessageTypeCombatInitiated  = "combat_initiated"
-	S2C_MessageTypeCombatUpdate     = "combat_update"
-	S2C_MessageTypePlayerStatUpdate = "player_stat_update"
-	C2S_MessageTypeUsePotion        = "use_potion"
-	S2C_MessageTypeNotification     = "notification"
+	S2C_MessageTypeInitialState      = "initial_state"
+	S2C_MessageTypePlayerJoined      = "player_joined"
+	S2C_MessageTypePlayerLeft        = "player_left"
+	S2C_MessageTypeEntityMoved       = "entity_moved"
+	S2C_MessageTypeMonsterSpawned    = "monster_spawned"
+	S2C_MessageTypeEntityRemoved     = "entity_removed"
+	S2C_MessageTypeCombatInitiated   = "combat_initiated"
+	S2C_MessageTypeCombatUpdate      = "combat_update"
+	S2C_MessageTypeCombatEnded       = "combat_ended"
+	S2C_MessageTypeFleeResult        = "flee_result"
+	S2C_MessageTypeEffectApplied     = "effect_applied"
+	S2C_MessageTypeEffectExpired     = "effect_expired"
+	S2C_MessageTypeEffectTick        = "effect_tick"
+	S2C_MessageTypePlayerStatUpdate  = "player_stat_update"
+	C2S_MessageTypeUsePotion         = "use_potion"
+	C2S_MessageTypeUseItem           = "use_item"
+	C2S_MessageTypeDropItem          = "drop_item"
+	C2S_MessageTypeInspectItem       = "inspect_item"
+	S2C_MessageTypeInventoryUpdate   = "inventory_update"
+	S2C_MessageTypeItemInfo          = "item_info"
+	C2S_MessageTypeEquip             = "equip"
+	C2S_MessageTypeUnequip           = "unequip"
+	C2S_MessageTypePickup            = "pickup"
+	S2C_MessageTypeGroundItemAdded   = "ground_item_added"
+	S2C_MessageTypeGroundItemRemoved = "ground_item_removed"
+	S2C_MessageTypeNotification      = "notification"
 )
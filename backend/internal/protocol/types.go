@@ -5,8 +5,17 @@ type TileType int
 const (
 	Grass TileType = iota
 	Stone
+	Water
+	Lava
+	Door
+	Bridge
+	Rubble // difficult terrain
+	StairsDown
+	StairsUp
 )
 
+// MonsterType is the ID of a monster archetype. The set of types comes from the
+// monster data file; these are the ones map spawn markers refer to by default.
 type MonsterType string
 
 const (
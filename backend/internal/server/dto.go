@@ -10,7 +10,7 @@ func NewS2C_MapData(world *game.World) protocol.S2C_MapData {
 	for y := 0; y < world.Height; y++ {
 		s2cTiles[y] = make([]protocol.S2C_TileData, world.Width)
 		for x := 0; x < world.Width; x++ {
-			s2cTiles[y][x] = protocol.S2C_TileData{Type: world.Tiles[y][x].Type}
+			s2cTiles[y][x] = NewS2C_TileData(world.Tiles[y][x].Type)
 		}
 	}
 	return protocol.S2C_MapData{
@@ -20,6 +20,18 @@ func NewS2C_MapData(world *game.World) protocol.S2C_MapData {
 	}
 }
 
+func NewS2C_TileData(t protocol.TileType) protocol.S2C_TileData {
+	props := game.TileProps(t)
+	return protocol.S2C_TileData{
+		Type:          t,
+		Name:          props.Name,
+		Passable:      props.Passable,
+		BlocksSight:   props.BlocksSight,
+		MoveCost:      props.MoveCost,
+		DamagePerStep: props.DamagePerStep,
+	}
+}
+
 func NewS2C_PlayerData(p *game.Player) protocol.S2C_PlayerData {
 	return protocol.S2C_PlayerData{
 		ID:        p.GetID(),
@@ -31,6 +43,10 @@ func NewS2C_PlayerData(p *game.Player) protocol.S2C_PlayerData {
 	}
 }
 
+func NewS2C_PlayerStatUpdatePayload(p *game.Player) protocol.S2C_PlayerStatUpdatePayload {
+	return p.StatUpdatePayload()
+}
+
 func NewS2C_MonsterData(m *game.Monster) protocol.S2C_MonsterData {
 	return protocol.S2C_MonsterData{
 		ID:        m.GetID(),
@@ -38,7 +54,33 @@ func NewS2C_MonsterData(m *game.Monster) protocol.S2C_MonsterData {
 		Y:         m.GetY(),
 		Type:      m.Type,
 		Name:      m.Name,
+		Glyph:     m.Glyph,
 		MaxHP:     m.MaxHP,
 		CurrentHP: m.CurrentHP,
 	}
 }
+
+func NewS2C_InventorySlotData(inv *game.Inventory, slot int, items map[game.ItemID]game.ItemDef) protocol.S2C_InventorySlotData {
+	stack, ok := inv.Get(slot)
+	if !ok {
+		return protocol.S2C_InventorySlotData{Slot: slot}
+	}
+	def := items[stack.Item]
+	return protocol.S2C_InventorySlotData{
+		Slot:   slot,
+		ItemID: string(stack.Item),
+		Name:   def.Name,
+		Kind:   string(def.Kind),
+		Count:  stack.Count,
+	}
+}
+
+func NewS2C_InventoryData(inv *game.Inventory, items map[game.ItemID]game.ItemDef) protocol.S2C_InventoryData {
+	data := protocol.S2C_InventoryData{Capacity: len(inv.Slots), Slots: []protocol.S2C_InventorySlotData{}}
+	for slot, stack := range inv.Slots {
+		if stack.Count > 0 {
+			data.Slots = append(data.Slots, NewS2C_InventorySlotData(inv, slot, items))
+		}
+	}
+	return data
+}
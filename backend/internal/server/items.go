@@ -0,0 +1,196 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"game-server/internal/game"
+	"game-server/internal/protocol"
+	"log"
+	"strings"
+)
+
+// useItem uses the item in slot and tells the player how it went. Healing is
+// broadcast as a stat update like any other HP change.
+func (c *Client) useItem(slot int) {
+	c.world.Mu.Lock()
+	if c.player.CurrentHP <= 0 {
+		c.world.Mu.Unlock()
+		c.sendNotification("You are defeated and cannot use items.", "warning")
+		return
+	}
+	use, err := c.world.UseItemInternal(c.player, slot)
+	if err != nil {
+		c.world.Mu.Unlock()
+		c.sendNotification(capitalize(err.Error())+".", "info")
+		return
+	}
+	inventoryUpdate := c.inventoryUpdateInternal(use.Changed)
+	statUpdate := NewS2C_PlayerStatUpdatePayload(c.player)
+	c.world.Mu.Unlock()
+
+	c.sendMessage(protocol.S2C_MessageTypeInventoryUpdate, inventoryUpdate)
+	c.broadcastStatUpdate(statUpdate)
+
+	message := fmt.Sprintf("You used the %s.", use.Def.Name)
+	if use.Healed > 0 {
+		message = fmt.Sprintf("You used the %s and healed for %d HP.", use.Def.Name, use.Healed)
+	}
+	c.sendNotification(message, "success")
+}
+
+// equipItem wears the item in inventory slot. The new stats are broadcast, since
+// other players see them too.
+func (c *Client) equipItem(slot int) {
+	c.world.Mu.Lock()
+	changed, err := c.world.EquipItemInternal(c.player, slot)
+	if err != nil {
+		c.world.Mu.Unlock()
+		c.sendNotification(capitalize(err.Error())+".", "info")
+		return
+	}
+	inventoryUpdate := c.inventoryUpdateInternal(changed)
+	statUpdate := NewS2C_PlayerStatUpdatePayload(c.player)
+	c.world.Mu.Unlock()
+
+	c.sendMessage(protocol.S2C_MessageTypeInventoryUpdate, inventoryUpdate)
+	c.broadcastStatUpdate(statUpdate)
+}
+
+func (c *Client) unequipItem(kind game.ItemKind) {
+	c.world.Mu.Lock()
+	changed, err := c.world.UnequipItemInternal(c.player, kind)
+	if err != nil {
+		c.world.Mu.Unlock()
+		c.sendNotification(capitalize(err.Error())+".", "info")
+		return
+	}
+	inventoryUpdate := c.inventoryUpdateInternal(changed)
+	statUpdate := NewS2C_PlayerStatUpdatePayload(c.player)
+	c.world.Mu.Unlock()
+
+	c.sendMessage(protocol.S2C_MessageTypeInventoryUpdate, inventoryUpdate)
+	c.broadcastStatUpdate(statUpdate)
+}
+
+func (c *Client) dropItem(slot, count int) {
+	c.world.Mu.Lock()
+	if stack, ok := c.player.Inventory.Get(slot); ok && count <= 0 {
+		count = stack.Count
+	}
+	dropped, err := c.world.DropItemInternal(c.player, slot, count)
+	if err != nil {
+		c.world.Mu.Unlock()
+		c.sendNotification(capitalize(err.Error())+".", "info")
+		return
+	}
+	name := c.world.Tuning.Items[dropped.Item].Name
+	inventoryUpdate := c.inventoryUpdateInternal([]int{slot})
+	c.world.Mu.Unlock()
+
+	c.sendMessage(protocol.S2C_MessageTypeInventoryUpdate, inventoryUpdate)
+	c.sendNotification(fmt.Sprintf("You dropped %d x %s.", dropped.Count, name), "info")
+}
+
+func (c *Client) inspectItem(slot int) {
+	c.world.Mu.Lock()
+	stack, ok := c.player.Inventory.Get(slot)
+	if !ok {
+		c.world.Mu.Unlock()
+		c.sendNotification("There is nothing in that slot.", "info")
+		return
+	}
+	def := c.world.Tuning.Items[stack.Item]
+	info := protocol.S2C_ItemInfoPayload{
+		S2C_InventorySlotData: NewS2C_InventorySlotData(c.player.Inventory, slot, c.world.Tuning.Items),
+		Description:           def.Description,
+		MaxStack:              max(def.MaxStack, 1),
+		Heal:                  def.Heal,
+		Effect:                string(def.Effect),
+		AttackMod:             def.AttackMod,
+		DefenseMod:            def.DefenseMod,
+		DamageType:            string(def.DamageType),
+	}
+	for _, id := range def.Cures {
+		info.Cures = append(info.Cures, string(id))
+	}
+	for d, v := range def.Resistances {
+		if info.Resistances == nil {
+			info.Resistances = map[string]float64{}
+		}
+		info.Resistances[string(d)] = v
+	}
+	c.world.Mu.Unlock()
+
+	c.sendMessage(protocol.S2C_MessageTypeItemInfo, info)
+}
+
+// pickUp takes the items on the player's tile, as many as fit.
+func (c *Client) pickUp() {
+	c.world.Mu.Lock()
+	result := c.pickUpInternal()
+	c.world.Mu.Unlock()
+
+	if len(result.picked) == 0 && !result.full {
+		c.sendNotification("There is nothing here to pick up.", "info")
+		return
+	}
+	c.sendPickupResult(result)
+}
+
+// pickupResult is what the player is told after picking items up.
+type pickupResult struct {
+	inventoryUpdate protocol.S2C_InventoryUpdatePayload
+	picked          []string
+	full            bool
+}
+
+// pickUpInternal picks up what lies on the player's tile.
+// Assumes c.world.Mu is HELD
+func (c *Client) pickUpInternal() pickupResult {
+	pickup := c.world.PickUpInternal(c.player)
+	result := pickupResult{inventoryUpdate: c.inventoryUpdateInternal(pickup.Changed), full: pickup.Full}
+	for _, stack := range pickup.Items {
+		result.picked = append(result.picked, fmt.Sprintf("%d x %s", stack.Count, c.world.Tuning.Items[stack.Item].Name))
+	}
+	return result
+}
+
+// sendPickupResult sends the player their changed slots and what they picked up.
+// It sends nothing when there was nothing on the tile.
+func (c *Client) sendPickupResult(result pickupResult) {
+	if len(result.inventoryUpdate.Slots) > 0 {
+		c.sendMessage(protocol.S2C_MessageTypeInventoryUpdate, result.inventoryUpdate)
+	}
+	for _, picked := range result.picked {
+		c.sendNotification(fmt.Sprintf("You picked up %s.", picked), "success")
+	}
+	if result.full {
+		c.sendNotification("Your inventory is full.", "warning")
+	}
+}
+
+// inventoryUpdateInternal describes the given slots of the client's inventory.
+// Assumes c.world.Mu is HELD
+func (c *Client) inventoryUpdateInternal(slots []int) protocol.S2C_InventoryUpdatePayload {
+	update := protocol.S2C_InventoryUpdatePayload{}
+	for _, slot := range slots {
+		update.Slots = append(update.Slots, NewS2C_InventorySlotData(c.player.Inventory, slot, c.world.Tuning.Items))
+	}
+	return update
+}
+
+func (c *Client) broadcastStatUpdate(statUpdate protocol.S2C_PlayerStatUpdatePayload) {
+	jsonStatMsg, err := json.Marshal(protocol.GenericMessage{Type: protocol.S2C_MessageTypePlayerStatUpdate, Payload: statUpdate})
+	if err != nil {
+		log.Printf("Error marshaling player stat update for %s: %v", c.player.GetID(), err)
+		return
+	}
+	c.broadcast(jsonStatMsg)
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
@@ -1,141 +1,114 @@
 package server
 
 import (
+	"crypto/subtle"
 	"encoding/json"
 	"fmt"
+	"game-server/internal/config"
 	"game-server/internal/game"
+	"game-server/internal/mapimage"
 	"game-server/internal/protocol"
 	"log"
 	"math/rand"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
 )
 
-const (
-	writeWait      = 10 * time.Second
-	pongWait       = 60 * time.Second
-	pingPeriod     = (pongWait * 9) / 10
-	maxMessageSize = 512
-)
-
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		return true
-	},
-}
-
 type Client struct {
 	hub    *Hub
 	conn   *websocket.Conn
 	send   chan []byte
 	player *game.Player
-	world  *game.World
+	// world is the floor the player is on. Only the client's readPump goroutine
+	// changes it; the Hub keeps its own copy in clients.
+	world *game.World
+
+	// sendMu guards closed, which is set once send has been closed so that late
+	// messages are dropped instead of panicking.
+	sendMu sync.Mutex
+	closed bool
+}
+
+// floorMessage is a broadcast for the clients on one floor, or for everyone when
+// world is nil.
+type floorMessage struct {
+	world *game.World
+	data  []byte
+}
+
+// floorChange tells the Hub a client has moved to another floor.
+type floorChange struct {
+	client *Client
+	from   *game.World
+	to     *game.World
 }
 
 type Hub struct {
-	clients    map[*Client]bool
-	broadcast  chan []byte
-	register   chan *Client
-	unregister chan *Client
-	world      *game.World
+	clients     map[*Client]*game.World
+	broadcast   chan floorMessage
+	register    chan *Client
+	unregister  chan *Client
+	changeFloor chan floorChange
+	dungeon     *game.Dungeon
+	cfg         *config.Config
+	upgrader    websocket.Upgrader
 }
 
-func NewHub(world *game.World) *Hub {
+func NewHub(dungeon *game.Dungeon, cfg *config.Config) *Hub {
 	return &Hub{
-		broadcast:  make(chan []byte, 256),
-		register:   make(chan *Client),
-		unregister: make(chan *Client),
-		clients:    make(map[*Client]bool),
-		world:      world,
+		broadcast:   make(chan floorMessage, 256),
+		register:    make(chan *Client),
+		unregister:  make(chan *Client),
+		changeFloor: make(chan floorChange),
+		clients:     make(map[*Client]*game.World),
+		dungeon:     dungeon,
+		cfg:         cfg,
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  cfg.ReadBufferSize,
+			WriteBufferSize: cfg.WriteBufferSize,
+			CheckOrigin: func(r *http.Request) bool {
+				return true
+			},
+		},
 	}
 }
 
+// floorBroadcaster lets a floor's World broadcast to the clients on that floor only.
+type floorBroadcaster struct {
+	hub   *Hub
+	world *game.World
+}
+
+func (f floorBroadcaster) Broadcast(message []byte) {
+	f.hub.BroadcastToFloor(f.world, message)
+}
+
 func (h *Hub) Run() {
 	log.Println("Hub started...")
 	for {
 		select {
 		case client := <-h.register:
-			h.clients[client] = true
+			h.clients[client] = client.world
 			log.Printf("Client registered: %s (Player ID: %s). Total clients: %d", client.conn.RemoteAddr(), client.player.GetID(), len(h.clients))
+			h.enterFloor(client, client.world)
 
-			h.world.Mu.Lock()
-			mapData := NewS2C_MapData(h.world)
-
-			var playersData []protocol.S2C_PlayerData
-			for _, p := range h.world.Players {
-				playersData = append(playersData, NewS2C_PlayerData(p))
-			}
-
-			var monstersData []protocol.S2C_MonsterData
-			for _, m := range h.world.Monsters {
-				monstersData = append(monstersData, NewS2C_MonsterData(m))
-			}
-			h.world.Mu.Unlock()
-
-			initialStatePayload := protocol.S2C_InitialStatePayload{
-				PlayerID: client.player.GetID(),
-				Map:      mapData,
-				Players:  playersData,
-				Monsters: monstersData,
-			}
-			initialStateMsg := protocol.GenericMessage{
-				Type:    protocol.S2C_MessageTypeInitialState,
-				Payload: initialStatePayload,
-			}
-			jsonInitialMsg, err := json.Marshal(initialStateMsg)
-			if err != nil {
-				log.Printf("Error marshaling initial state for player %s: %v", client.player.GetID(), err)
-			} else {
-				select {
-				case client.send <- jsonInitialMsg:
-					log.Printf("Sent initial state to player %s", client.player.GetID())
-				default:
-					log.Printf("Failed to send initial state to player %s: send channel blocked/closed.", client.player.GetID())
-				}
-			}
-
-			playerJoinedPayload := protocol.S2C_PlayerJoinedPayload{
-				S2C_PlayerData: NewS2C_PlayerData(client.player),
-			}
-			playerJoinedMsg := protocol.GenericMessage{
-				Type:    protocol.S2C_MessageTypePlayerJoined,
-				Payload: playerJoinedPayload,
-			}
-			jsonPlayerJoinedMsg, err := json.Marshal(playerJoinedMsg)
-			if err != nil {
-				log.Printf("Error marshaling player joined message for %s: %v", client.player.GetID(), err)
-			} else {
-				h.broadcast <- jsonPlayerJoinedMsg
-				log.Printf("Scheduled broadcast for player joined: %s", client.player.GetID())
+		case change := <-h.changeFloor:
+			if _, ok := h.clients[change.client]; !ok {
+				continue // disconnected while taking the stairs
 			}
+			h.clients[change.client] = change.to
+			h.queuePlayerLeft(change.from, change.client.player.GetID())
+			h.enterFloor(change.client, change.to)
 
 		case client := <-h.unregister:
 			if _, ok := h.clients[client]; ok {
-				playerIDToBroadcast := client.player.GetID()
-
-				delete(h.clients, client)
-				close(client.send)
-				h.world.RemovePlayer(playerIDToBroadcast)
-				log.Printf("Client unregistered: Player ID: %s. Player removed. Total clients: %d", playerIDToBroadcast, len(h.clients))
-
-				playerLeftPayload := protocol.S2C_PlayerLeftPayload{
-					ID: playerIDToBroadcast,
-				}
-				playerLeftMsg := protocol.GenericMessage{
-					Type:    protocol.S2C_MessageTypePlayerLeft,
-					Payload: playerLeftPayload,
-				}
-				jsonPlayerLeftMsg, err := json.Marshal(playerLeftMsg)
-				if err != nil {
-					log.Printf("Error marshaling player left message for %s: %v", playerIDToBroadcast, err)
-				} else {
-					h.broadcast <- jsonPlayerLeftMsg
-					log.Printf("Scheduled broadcast for player left: %s", playerIDToBroadcast)
-				}
+				h.removeClient(client)
+				log.Printf("Client unregistered: Player ID: %s. Player removed. Total clients: %d", client.player.GetID(), len(h.clients))
 			}
 
 		case message := <-h.broadcast:
@@ -144,29 +117,146 @@ func (h *Hub) Run() {
 				continue
 			}
 
-			for c := range h.clients {
-				select {
-				case c.send <- message:
-				default:
+			for c, floor := range h.clients {
+				if message.world != nil && message.world != floor {
+					continue
+				}
+				if !c.trySend(message.data) {
 					log.Printf("Client %s send buffer full or slow during broadcast. Removing from broadcast.", c.conn.RemoteAddr())
-					playerID := c.player.GetID()
-					delete(h.clients, c)
-					close(c.send)
-					log.Printf("Forcefully removed client %s (Player %s) from broadcast recipients due to slow send.", c.conn.RemoteAddr(), playerID)
+					h.removeClient(c)
+					log.Printf("Forcefully removed client %s (Player %s) due to slow send.", c.conn.RemoteAddr(), c.player.GetID())
 				}
 			}
 		}
 	}
 }
 
+// removeClient drops a client that disconnected or fell too far behind: its player
+// leaves the dungeon, and any fight with it, and the rest of its floor is told.
+// Closing the connection stops its readPump, whose unregister is then a no-op.
+// Only called from Run.
+func (h *Hub) removeClient(client *Client) {
+	playerID := client.player.GetID()
+	delete(h.clients, client)
+	client.closeSend()
+	client.conn.Close()
+	if floor := h.dungeon.RemovePlayer(playerID); floor != nil {
+		h.queuePlayerLeft(floor, playerID)
+	}
+}
+
+// enterFloor sends the client the full state of world and tells the other players
+// on that floor it has arrived. Only called from Run.
+func (h *Hub) enterFloor(client *Client, world *game.World) {
+	world.Mu.Lock()
+	mapData := NewS2C_MapData(world)
+
+	var playersData []protocol.S2C_PlayerData
+	for _, p := range world.Players {
+		playersData = append(playersData, NewS2C_PlayerData(p))
+	}
+
+	var monstersData []protocol.S2C_MonsterData
+	for _, m := range world.Monsters {
+		monstersData = append(monstersData, NewS2C_MonsterData(m))
+	}
+	inventoryData := NewS2C_InventoryData(client.player.Inventory, world.Tuning.Items)
+	groundItemsData := []protocol.S2C_GroundItemData{}
+	for _, item := range world.GroundItemsInternal() {
+		groundItemsData = append(groundItemsData, world.GroundItemData(item))
+	}
+	world.Mu.Unlock()
+
+	initialStatePayload := protocol.S2C_InitialStatePayload{
+		PlayerID:    client.player.GetID(),
+		Seed:        world.Seed,
+		Floor:       world.Depth,
+		FloorCount:  len(h.dungeon.Floors),
+		Map:         mapData,
+		Players:     playersData,
+		Monsters:    monstersData,
+		Inventory:   inventoryData,
+		GroundItems: groundItemsData,
+	}
+	initialStateMsg := protocol.GenericMessage{
+		Type:    protocol.S2C_MessageTypeInitialState,
+		Payload: initialStatePayload,
+	}
+	jsonInitialMsg, err := json.Marshal(initialStateMsg)
+	if err != nil {
+		log.Printf("Error marshaling initial state for player %s: %v", client.player.GetID(), err)
+	} else {
+		if client.trySend(jsonInitialMsg) {
+			log.Printf("Sent initial state of floor %d to player %s", world.Depth, client.player.GetID())
+		} else {
+			log.Printf("Failed to send initial state to player %s: send channel blocked/closed.", client.player.GetID())
+		}
+	}
+
+	playerJoinedPayload := protocol.S2C_PlayerJoinedPayload{
+		S2C_PlayerData: NewS2C_PlayerData(client.player),
+	}
+	playerJoinedMsg := protocol.GenericMessage{
+		Type:    protocol.S2C_MessageTypePlayerJoined,
+		Payload: playerJoinedPayload,
+	}
+	jsonPlayerJoinedMsg, err := json.Marshal(playerJoinedMsg)
+	if err != nil {
+		log.Printf("Error marshaling player joined message for %s: %v", client.player.GetID(), err)
+	} else {
+		h.BroadcastToFloor(world, jsonPlayerJoinedMsg)
+		log.Printf("Scheduled broadcast for player joined: %s", client.player.GetID())
+	}
+}
+
+func (h *Hub) queuePlayerLeft(world *game.World, playerID string) {
+	playerLeftPayload := protocol.S2C_PlayerLeftPayload{
+		ID: playerID,
+	}
+	playerLeftMsg := protocol.GenericMessage{
+		Type:    protocol.S2C_MessageTypePlayerLeft,
+		Payload: playerLeftPayload,
+	}
+	jsonPlayerLeftMsg, err := json.Marshal(playerLeftMsg)
+	if err != nil {
+		log.Printf("Error marshaling player left message for %s: %v", playerID, err)
+	} else {
+		h.BroadcastToFloor(world, jsonPlayerLeftMsg)
+		log.Printf("Scheduled broadcast for player left: %s", playerID)
+	}
+}
+
+// Broadcast sends message to every connected client, whatever floor they are on.
 func (h *Hub) Broadcast(message []byte) {
+	h.BroadcastToFloor(nil, message)
+}
+
+// BroadcastToFloor sends message to the clients on world, or to everyone if world is nil.
+func (h *Hub) BroadcastToFloor(world *game.World, message []byte) {
 	select {
-	case h.broadcast <- message:
+	case h.broadcast <- floorMessage{world: world, data: message}:
 	default:
 		log.Printf("Hub's main broadcast channel is full during Hub.Broadcast(). Message dropped.")
 	}
 }
 
+// broadcast sends message to the players on the client's current floor.
+func (c *Client) broadcast(message []byte) {
+	c.hub.BroadcastToFloor(c.world, message)
+}
+
+// useStairs moves the player to the floor its stairs lead to. The Hub then sends the
+// new floor's state and announces the move on both floors.
+func (c *Client) useStairs() {
+	from := c.world
+	to, ok := c.hub.dungeon.UseStairs(c.player, from)
+	if !ok {
+		return
+	}
+	c.world = to
+	c.hub.changeFloor <- floorChange{client: c, from: from, to: to}
+}
+
 func (c *Client) processIncomingMessage(genericMsg protocol.GenericMessage) {
 	switch genericMsg.Type {
 	case protocol.C2S_MessageTypeMove:
@@ -187,6 +277,10 @@ func (c *Client) processIncomingMessage(genericMsg protocol.GenericMessage) {
 		var moved bool
 		var engagedMonster *game.Monster
 		var playerCurrentX, playerCurrentY int
+		var stepDamage int
+		var stepMessage string
+		var stepDefeated bool
+		var stepStatUpdate protocol.S2C_PlayerStatUpdatePayload
 
 		c.world.Mu.Lock()
 
@@ -195,36 +289,36 @@ func (c *Client) processIncomingMessage(genericMsg protocol.GenericMessage) {
 		playerCurrentX = c.player.GetX()
 		playerCurrentY = c.player.GetY()
 
-		if engagedMonster != nil {
-			c.player.IsInCombat = true
-			c.player.CombatTargetID = engagedMonster.GetID()
-			engagedMonster.IsInCombat = true
-			engagedMonster.CombatTargetID = c.player.GetID()
-
-			log.Printf("Combat initiated: Player %s vs Monster %s (%s)", c.player.GetID(), engagedMonster.GetID(), engagedMonster.Name)
-
-			combatInitiatedPayload := protocol.S2C_CombatInitiatedPayload{
-				PlayerID:  c.player.GetID(),
-				MonsterID: engagedMonster.GetID(),
-				PlayerX:   playerCurrentX,
-				PlayerY:   playerCurrentY,
-				MonsterX:  engagedMonster.GetX(),
-				MonsterY:  engagedMonster.GetY(),
-			}
-			combatMsg := protocol.GenericMessage{
-				Type:    protocol.S2C_MessageTypeCombatInitiated,
-				Payload: combatInitiatedPayload,
-			}
-			jsonCombatMsg, marshalErr := json.Marshal(combatMsg)
-			if marshalErr != nil {
-				log.Printf("Player %s: Error marshaling S2C_CombatInitiated message: %v", c.player.GetID(), marshalErr)
-			} else {
-				c.hub.Broadcast(jsonCombatMsg)
+		var onStairs bool
+		if moved {
+			tileType := c.world.GetTile(playerCurrentX, playerCurrentY).Type
+			onStairs = tileType == protocol.StairsDown || tileType == protocol.StairsUp
+			stepProps := game.TileProps(tileType)
+			stepDamage = stepProps.DamagePerStep
+			if stepDamage > 0 {
+				stepMessage = stepProps.StepDamageMessage(stepDamage)
+				stepDefeated = c.player.TakeDamage(stepDamage)
+				if stepDefeated {
+					log.Printf("Player %s was defeated by the terrain at (%d,%d)!", c.player.GetID(), playerCurrentX, playerCurrentY)
+					c.world.DefeatPlayerInternal(c.player)
+				}
+				stepStatUpdate = NewS2C_PlayerStatUpdatePayload(c.player)
 			}
 		}
 
+		var pickup pickupResult
+		if moved && !stepDefeated {
+			pickup = c.pickUpInternal()
+		}
+
+		if engagedMonster != nil {
+			c.world.StartCombatInternal(c.player, engagedMonster)
+		}
+
 		c.world.Mu.Unlock()
 
+		c.sendPickupResult(pickup)
+
 		if moved {
 			log.Printf("Player %s successfully moved to (%d, %d)", c.player.GetID(), playerCurrentX, playerCurrentY)
 
@@ -242,18 +336,32 @@ func (c *Client) processIncomingMessage(genericMsg protocol.GenericMessage) {
 			if marshalErr != nil {
 				log.Printf("Player %s: Error marshaling S2C_EntityMoved message: %v", c.player.GetID(), marshalErr)
 			} else {
-				c.hub.Broadcast(jsonMsg)
+				c.broadcast(jsonMsg)
+			}
+
+			if stepDamage > 0 {
+				playerStatMsg := protocol.GenericMessage{Type: protocol.S2C_MessageTypePlayerStatUpdate, Payload: stepStatUpdate}
+				jsonPlayerStatMsg, errPSU := json.Marshal(playerStatMsg)
+				if errPSU == nil {
+					c.broadcast(jsonPlayerStatMsg)
+				} else {
+					log.Printf("Error marshaling player stat update after terrain damage: %v", errPSU)
+				}
+
+				if stepDefeated {
+					c.sendNotification("The terrain overwhelmed you. You are back to level 1.", "error")
+				} else {
+					c.sendNotification(stepMessage, "error")
+				}
+			}
+			if onStairs && !stepDefeated {
+				c.useStairs()
 			}
 		} else if engagedMonster == nil {
 
 			log.Printf("Player %s move (dx=%d, dy=%d) was invalid and no combat initiated. Current pos: (%d,%d)", c.player.GetID(), movePayload.DX, movePayload.DY, playerCurrentX, playerCurrentY)
 		}
 	case protocol.C2S_MessageTypeAttack:
-		if !c.player.IsInCombat || c.player.CombatTargetID == "" {
-			log.Printf("Player %s sent attack command but is not in combat or has no target.", c.player.GetID())
-			return
-		}
-
 		var attackPayload protocol.C2S_AttackPayload
 		payloadBytes, err := json.Marshal(genericMsg.Payload)
 		if err != nil {
@@ -265,32 +373,56 @@ func (c *Client) processIncomingMessage(genericMsg protocol.GenericMessage) {
 			return
 		}
 
-		if attackPayload.TargetID != c.player.CombatTargetID {
-			log.Printf("Player %s attacked target %s, but current combat target is %s.", c.player.GetID(), attackPayload.TargetID, c.player.CombatTargetID)
-			return
-		}
-
 		log.Printf("Player %s attacking Monster %s", c.player.GetID(), attackPayload.TargetID)
 
 		var defeatedMonsterID string
+		var xpStatUpdates []protocol.S2C_PlayerStatUpdatePayload
 
 		c.world.Mu.Lock()
 
+		// The tick loop also starts and ends fights, so the combat fields are only
+		// read with the lock held.
+		if !c.player.IsInCombat || c.player.CombatTargetID == "" {
+			c.world.Mu.Unlock()
+			log.Printf("Player %s sent attack command but is not in combat or has no target.", c.player.GetID())
+			return
+		}
+		if attackPayload.TargetID != c.player.CombatTargetID {
+			log.Printf("Player %s attacked target %s, but current combat target is %s.", c.player.GetID(), attackPayload.TargetID, c.player.CombatTargetID)
+			c.world.Mu.Unlock()
+			return
+		}
+
 		monster, monsterExists := c.world.Monsters[attackPayload.TargetID]
-		if !monsterExists || monster == nil || !monster.IsInCombat || monster.CombatTargetID != c.player.GetID() {
+		var session *game.CombatSession
+		if monsterExists && monster != nil {
+			session = c.world.CombatSessionInternal(monster)
+		}
+		if session == nil || !session.HasAttacker(c.player) {
 			log.Printf("Player %s attack failed: Monster %s not valid or not in combat with player.", c.player.GetID(), attackPayload.TargetID)
 			c.world.Mu.Unlock()
 			return
 		}
-
-		damageDealt := c.player.Attack - monster.Defense
-		if damageDealt < 0 {
-			damageDealt = 0
+		if c.player.Effects.Stunned() {
+			c.world.Mu.Unlock()
+			c.sendNotification("You are stunned!", "warning")
+			return
+		}
+		if damageType := c.player.AttackDamageType(); attackPayload.DamageType != "" && game.DamageType(attackPayload.DamageType) != damageType {
+			c.world.Mu.Unlock()
+			log.Printf("Player %s attacked with %q damage but wields %s.", c.player.GetID(), attackPayload.DamageType, damageType)
+			c.sendNotification(fmt.Sprintf("Your weapon deals %s damage.", damageType), "warning")
+			return
 		}
+		c.world.RecordCombatActionInternal(session)
+
+		playerAttack := c.world.ResolveAttackInternal(c.player, monster)
+		damageDealt := playerAttack.Damage
 		isMonsterDefeated := monster.TakeDamage(damageDealt)
+		session.RecordHit(c.player, damageDealt)
 
-		log.Printf("Player %s dealt %d damage to Monster %s. Monster HP: %d/%d.",
-			c.player.GetID(), damageDealt, monster.GetID(), monster.CurrentHP, monster.MaxHP)
+		log.Printf("Player %s dealt %d %s damage (%s) to Monster %s (hit: %t, critical: %t). Monster HP: %d/%d.",
+			c.player.GetID(), damageDealt, playerAttack.Type, playerAttack.Effectiveness, monster.GetID(), playerAttack.Hit, playerAttack.Critical, monster.CurrentHP, monster.MaxHP)
 
 		playerAttackCombatUpdate := protocol.S2C_CombatUpdatePayload{
 			AttackerID:         c.player.GetID(),
@@ -298,14 +430,23 @@ func (c *Client) processIncomingMessage(genericMsg protocol.GenericMessage) {
 			DamageDealt:        damageDealt,
 			DefenderCurrentHP:  monster.CurrentHP,
 			IsDefenderDefeated: isMonsterDefeated,
+			Missed:             !playerAttack.Hit,
+			Critical:           playerAttack.Critical,
+			DamageType:         string(playerAttack.Type),
+			Effectiveness:      playerAttack.Effectiveness,
 		}
 
 		if isMonsterDefeated {
 			log.Printf("Monster %s was defeated by Player %s!", monster.GetID(), c.player.GetID())
 			defeatedMonsterID = monster.GetID()
-
-			c.player.IsInCombat = false
-			c.player.CombatTargetID = ""
+			for _, award := range c.world.AwardXPInternal(session) {
+				log.Printf("Player %s gained %d XP for Monster %s. Leveled up: %t", award.Player.GetID(), award.XP, monster.GetID(), award.LeveledUp)
+				xpStatUpdates = append(xpStatUpdates, NewS2C_PlayerStatUpdatePayload(award.Player))
+			}
+			c.world.EndCombatInternal(session, game.CombatEndMonsterDefeated)
+			c.world.DropLootInternal(monster)
+			// Removed before the lock is released, so nobody can fight or kill it again.
+			c.world.RemoveMonsterInternal(defeatedMonsterID)
 		}
 
 		c.world.Mu.Unlock()
@@ -313,7 +454,7 @@ func (c *Client) processIncomingMessage(genericMsg protocol.GenericMessage) {
 		combatUpdateMsg := protocol.GenericMessage{Type: protocol.S2C_MessageTypeCombatUpdate, Payload: playerAttackCombatUpdate}
 		jsonCombatUpdateMsg, errCU := json.Marshal(combatUpdateMsg)
 		if errCU == nil {
-			c.hub.Broadcast(jsonCombatUpdateMsg)
+			c.broadcast(jsonCombatUpdateMsg)
 		} else {
 			log.Printf("Error marshaling player attack combat update: %v", errCU)
 		}
@@ -326,41 +467,19 @@ func (c *Client) processIncomingMessage(genericMsg protocol.GenericMessage) {
 			entityRemovedMsg := protocol.GenericMessage{Type: protocol.S2C_MessageTypeEntityRemoved, Payload: entityRemovedPayload}
 			jsonEntityRemovedMsg, errER := json.Marshal(entityRemovedMsg)
 			if errER == nil {
-				c.hub.Broadcast(jsonEntityRemovedMsg)
+				c.broadcast(jsonEntityRemovedMsg)
 			} else {
 				log.Printf("Error marshaling entity removed: %v", errER)
 			}
 
-			c.world.RemoveMonster(defeatedMonsterID)
-
-			var playerLeveledUp bool
-			var statUpdatePayload protocol.S2C_PlayerStatUpdatePayload
-
-			c.world.Mu.Lock()
-
-			xpGained := monster.XPValue
-
-			playerLeveledUp = c.player.GainXP(xpGained)
-
-			statUpdatePayload = protocol.S2C_PlayerStatUpdatePayload{
-				PlayerID:      c.player.GetID(),
-				Level:         c.player.Level,
-				XP:            c.player.XP,
-				XPToNextLevel: c.player.XPToNextLevel,
-				MaxHP:         c.player.MaxHP,
-				CurrentHP:     c.player.CurrentHP,
-				Attack:        c.player.Attack,
-				Defense:       c.player.Defense,
-			}
-			c.world.Mu.Unlock()
-
-			playerStatMsg := protocol.GenericMessage{Type: protocol.S2C_MessageTypePlayerStatUpdate, Payload: statUpdatePayload}
-			jsonPlayerStatMsg, errPSU := json.Marshal(playerStatMsg)
-			if errPSU == nil {
-				c.hub.Broadcast(jsonPlayerStatMsg)
-				log.Printf("Player %s stats updated and broadcasted. Leveled up: %t", c.player.GetID(), playerLeveledUp)
-			} else {
-				log.Printf("Error marshaling player stat update after monster defeat: %v", errPSU)
+			for _, statUpdatePayload := range xpStatUpdates {
+				playerStatMsg := protocol.GenericMessage{Type: protocol.S2C_MessageTypePlayerStatUpdate, Payload: statUpdatePayload}
+				jsonPlayerStatMsg, errPSU := json.Marshal(playerStatMsg)
+				if errPSU == nil {
+					c.broadcast(jsonPlayerStatMsg)
+				} else {
+					log.Printf("Error marshaling player stat update after monster defeat: %v", errPSU)
+				}
 			}
 		} else {
 			log.Printf("Monster %s (HP: %d/%d) survived. Retaliating...", monster.GetID(), monster.CurrentHP, monster.MaxHP)
@@ -370,46 +489,54 @@ func (c *Client) processIncomingMessage(genericMsg protocol.GenericMessage) {
 
 			c.world.Mu.Lock()
 
-			monsterDamageDealt := monster.Attack - c.player.Defense
-			if monsterDamageDealt < 0 {
-				monsterDamageDealt = 0
+			// The fight may have ended while the lock was released.
+			if c.world.CombatSessionInternal(monster) != session {
+				c.world.Mu.Unlock()
+				return
+			}
+			if monster.Effects.Stunned() {
+				c.world.Mu.Unlock()
+				log.Printf("Monster %s is stunned and does not retaliate.", monster.GetID())
+				return
 			}
-			isPlayerDefeated := c.player.TakeDamage(monsterDamageDealt)
 
-			log.Printf("Monster %s dealt %d damage to Player %s. Player HP: %d/%d.",
-				monster.GetID(), monsterDamageDealt, c.player.GetID(), c.player.CurrentHP, c.player.MaxHP)
+			// The monster hits back at whoever has the most threat, not necessarily
+			// the player who just attacked.
+			target := session.Target()
+			monsterAttack := c.world.ResolveAttackInternal(monster, target)
+			monsterDamageDealt := monsterAttack.Damage
+			isPlayerDefeated := target.TakeDamage(monsterDamageDealt)
+
+			log.Printf("Monster %s dealt %d damage to Player %s (hit: %t, critical: %t). Player HP: %d/%d.",
+				monster.GetID(), monsterDamageDealt, target.GetID(), monsterAttack.Hit, monsterAttack.Critical, target.CurrentHP, target.MaxHP)
 
 			monsterAttackCombatUpdate = protocol.S2C_CombatUpdatePayload{
 				AttackerID:         monster.GetID(),
-				DefenderID:         c.player.GetID(),
+				DefenderID:         target.GetID(),
 				DamageDealt:        monsterDamageDealt,
-				DefenderCurrentHP:  c.player.CurrentHP,
+				DefenderCurrentHP:  target.CurrentHP,
 				IsDefenderDefeated: isPlayerDefeated,
+				Missed:             !monsterAttack.Hit,
+				Critical:           monsterAttack.Critical,
+				DamageType:         string(monsterAttack.Type),
+				Effectiveness:      monsterAttack.Effectiveness,
 			}
 
 			if isPlayerDefeated {
-				log.Printf("Player %s was defeated by Monster %s!", c.player.GetID(), monster.GetID())
-				c.player.ResetToLevel1()
-				monster.IsInCombat = false
-				monster.CombatTargetID = ""
-
-				playerStatUpdateForDefeat = &protocol.S2C_PlayerStatUpdatePayload{
-					PlayerID:      c.player.GetID(),
-					Level:         c.player.Level,
-					XP:            c.player.XP,
-					XPToNextLevel: c.player.XPToNextLevel,
-					MaxHP:         c.player.MaxHP,
-					CurrentHP:     c.player.CurrentHP,
-					Attack:        c.player.Attack,
-					Defense:       c.player.Defense,
-				}
+				log.Printf("Player %s was defeated by Monster %s!", target.GetID(), monster.GetID())
+				c.world.DefeatPlayerInternal(target)
+
+				statUpdate := NewS2C_PlayerStatUpdatePayload(target)
+				playerStatUpdateForDefeat = &statUpdate
+			} else if monsterAttack.Hit {
+				c.world.ApplyOnHitEffectsInternal(monster, target)
 			}
 			c.world.Mu.Unlock()
 
 			monsterAttackMsg := protocol.GenericMessage{Type: protocol.S2C_MessageTypeCombatUpdate, Payload: monsterAttackCombatUpdate}
 			jsonMonsterAttackMsg, errMA := json.Marshal(monsterAttackMsg)
 			if errMA == nil {
-				c.hub.Broadcast(jsonMonsterAttackMsg)
+				c.broadcast(jsonMonsterAttackMsg)
 			} else { /* log */
 			}
 
@@ -417,88 +544,191 @@ func (c *Client) processIncomingMessage(genericMsg protocol.GenericMessage) {
 				playerStatMsg := protocol.GenericMessage{Type: protocol.S2C_MessageTypePlayerStatUpdate, Payload: *playerStatUpdateForDefeat}
 				jsonPlayerStatMsg, errPSU := json.Marshal(playerStatMsg)
 				if errPSU == nil {
-					c.hub.Broadcast(jsonPlayerStatMsg)
+					c.broadcast(jsonPlayerStatMsg)
 				} else { /* log */
 				}
 			}
 		}
-	case protocol.C2S_MessageTypeUsePotion:
-		log.Printf("Player %s attempting to use a potion.", c.player.GetID())
-
-		var actualHealAmount int
-		var notificationMsg string
-
+	case protocol.C2S_MessageTypeFlee:
 		c.world.Mu.Lock()
-		if c.player.CurrentHP <= 0 {
-			log.Printf("Player %s cannot use potion, is defeated.", c.player.GetID())
-			notificationMsg = "You are defeated and cannot use a potion."
-		} else if c.player.CurrentHP >= c.player.MaxHP {
-			log.Printf("Player %s is already at full health.", c.player.GetID())
-			notificationMsg = "You are already at full health."
-
-		} else {
-			potionHealAmount := 30
-			actualHealAmount = c.player.Heal(potionHealAmount)
-			if actualHealAmount > 0 {
-				notificationMsg = fmt.Sprintf("You healed for %d HP.", actualHealAmount)
-			} else {
-				notificationMsg = "You feel no different."
-			}
+		if c.player.IsInCombat && c.player.Effects.Stunned() {
+			c.world.Mu.Unlock()
+			c.sendNotification("You are stunned and can't run!", "warning")
+			return
 		}
-
-		statUpdatePayload := protocol.S2C_PlayerStatUpdatePayload{
-			PlayerID:      c.player.GetID(),
-			Level:         c.player.Level,
-			XP:            c.player.XP,
-			XPToNextLevel: c.player.XPToNextLevel,
-			MaxHP:         c.player.MaxHP,
-			CurrentHP:     c.player.CurrentHP,
-			Attack:        c.player.Attack,
-			Defense:       c.player.Defense,
+		result, inCombat := c.world.FleeInternal(c.player)
+		if !inCombat {
+			c.world.Mu.Unlock()
+			log.Printf("Player %s tried to flee but is not in combat.", c.player.GetID())
+			return
+		}
+		if result.Blocked {
+			c.world.Mu.Unlock()
+			c.sendNotification("There is nowhere to run!", "warning")
+			return
 		}
+		fleePayload := protocol.S2C_FleeResultPayload{
+			PlayerID:        c.player.GetID(),
+			MonsterID:       result.Monster.GetID(),
+			Escaped:         result.Escaped,
+			Chance:          result.Chance,
+			DamageTaken:     result.Damage,
+			PlayerCurrentHP: c.player.CurrentHP,
+			X:               c.player.GetX(),
+			Y:               c.player.GetY(),
+		}
+		statUpdate := NewS2C_PlayerStatUpdatePayload(c.player)
 		c.world.Mu.Unlock()
 
-		playerStatMsg := protocol.GenericMessage{Type: protocol.S2C_MessageTypePlayerStatUpdate, Payload: statUpdatePayload}
-		jsonPlayerStatMsg, errPSU := json.Marshal(playerStatMsg)
-		if errPSU == nil {
-			c.hub.Broadcast(jsonPlayerStatMsg)
+		fleeMsg := protocol.GenericMessage{Type: protocol.S2C_MessageTypeFleeResult, Payload: fleePayload}
+		jsonFleeMsg, err := json.Marshal(fleeMsg)
+		if err != nil {
+			log.Printf("Error marshaling flee result for %s: %v", c.player.GetID(), err)
 		} else {
-			log.Printf("Error marshaling player stat update after potion use: %v", errPSU)
+			c.broadcast(jsonFleeMsg)
 		}
 
-		if notificationMsg != "" {
-			notificationPayload := protocol.S2C_NotificationPayload{
-				Message: notificationMsg,
-				Level:   "info",
-			}
-			if actualHealAmount > 0 {
-				notificationPayload.Level = "success"
+		if result.Escaped {
+			movedPayload := protocol.S2C_EntityMovedPayload{
+				ID:         c.player.GetID(),
+				EntityType: protocol.EntityTypePlayer,
+				X:          fleePayload.X,
+				Y:          fleePayload.Y,
 			}
-
-			notifyMsg := protocol.GenericMessage{Type: protocol.S2C_MessageTypeNotification, Payload: notificationPayload}
-			jsonNotifyMsg, errNotify := json.Marshal(notifyMsg)
-			if errNotify == nil {
-				select {
-				case c.send <- jsonNotifyMsg:
-				default:
-					log.Printf("Failed to send potion use notification to %s: channel full/closed", c.player.GetID())
-				}
+			jsonMovedMsg, err := json.Marshal(protocol.GenericMessage{Type: protocol.S2C_MessageTypeEntityMoved, Payload: movedPayload})
+			if err == nil {
+				c.broadcast(jsonMovedMsg)
 			} else {
-				log.Printf("Error marshaling potion notification: %v", errNotify)
+				log.Printf("Error marshaling move after flee for %s: %v", c.player.GetID(), err)
 			}
+			c.sendNotification(fmt.Sprintf("You got away from the %s.", result.Monster.Name), "success")
+			return
+		}
+
+		jsonStatMsg, err := json.Marshal(protocol.GenericMessage{Type: protocol.S2C_MessageTypePlayerStatUpdate, Payload: statUpdate})
+		if err == nil {
+			c.broadcast(jsonStatMsg)
+		} else {
+			log.Printf("Error marshaling player stat update after failed flee: %v", err)
 		}
+		if result.Defeated {
+			c.sendNotification(fmt.Sprintf("The %s cut you down as you ran. You are back to level 1.", result.Monster.Name), "error")
+		} else {
+			c.sendNotification(fmt.Sprintf("You failed to get away and the %s hit you for %d.", result.Monster.Name, result.Damage), "warning")
+		}
+	case protocol.C2S_MessageTypeUsePotion:
+		log.Printf("Player %s attempting to use a potion.", c.player.GetID())
+		c.world.Mu.Lock()
+		slot := c.player.Inventory.Find(game.ItemHealingPotion)
+		c.world.Mu.Unlock()
+		if slot < 0 {
+			c.sendNotification("You have no potions left.", "warning")
+			return
+		}
+		c.useItem(slot)
+	case protocol.C2S_MessageTypeUseItem:
+		var payload protocol.C2S_UseItemPayload
+		if err := decodePayload(genericMsg, &payload); err != nil {
+			log.Printf("Player %s: Error decoding C2S_UseItemPayload: %v", c.player.GetID(), err)
+			return
+		}
+		c.useItem(payload.Slot)
+	case protocol.C2S_MessageTypeDropItem:
+		var payload protocol.C2S_DropItemPayload
+		if err := decodePayload(genericMsg, &payload); err != nil {
+			log.Printf("Player %s: Error decoding C2S_DropItemPayload: %v", c.player.GetID(), err)
+			return
+		}
+		c.dropItem(payload.Slot, payload.Count)
+	case protocol.C2S_MessageTypeInspectItem:
+		var payload protocol.C2S_InspectItemPayload
+		if err := decodePayload(genericMsg, &payload); err != nil {
+			log.Printf("Player %s: Error decoding C2S_InspectItemPayload: %v", c.player.GetID(), err)
+			return
+		}
+		c.inspectItem(payload.Slot)
+	case protocol.C2S_MessageTypePickup:
+		c.pickUp()
+	case protocol.C2S_MessageTypeEquip:
+		var payload protocol.C2S_EquipPayload
+		if err := decodePayload(genericMsg, &payload); err != nil {
+			log.Printf("Player %s: Error decoding C2S_EquipPayload: %v", c.player.GetID(), err)
+			return
+		}
+		c.equipItem(payload.Slot)
+	case protocol.C2S_MessageTypeUnequip:
+		var payload protocol.C2S_UnequipPayload
+		if err := decodePayload(genericMsg, &payload); err != nil {
+			log.Printf("Player %s: Error decoding C2S_UnequipPayload: %v", c.player.GetID(), err)
+			return
+		}
+		c.unequipItem(game.ItemKind(payload.Slot))
 	default:
 		log.Printf("Player %s: Received unknown message type '%s'", c.player.GetID(), genericMsg.Type)
 	}
 }
 
+// sendNotification sends a notification to this client only.
+func (c *Client) sendNotification(message, level string) {
+	c.sendMessage(protocol.S2C_MessageTypeNotification, protocol.S2C_NotificationPayload{Message: message, Level: level})
+}
+
+// sendMessage sends a message to this client only.
+func (c *Client) sendMessage(msgType string, payload interface{}) {
+	jsonMsg, err := json.Marshal(protocol.GenericMessage{Type: msgType, Payload: payload})
+	if err != nil {
+		log.Printf("Error marshaling %s message for %s: %v", msgType, c.player.GetID(), err)
+		return
+	}
+	if !c.trySend(jsonMsg) {
+		log.Printf("Failed to send %s message to %s: channel full/closed", msgType, c.player.GetID())
+	}
+}
+
+// trySend queues message for the client without blocking. It reports false if the
+// buffer is full or the client has been removed.
+func (c *Client) trySend(message []byte) bool {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+	if c.closed {
+		return false
+	}
+	select {
+	case c.send <- message:
+		return true
+	default:
+		return false
+	}
+}
+
+// closeSend closes the send channel, which makes writePump finish. Later sends are
+// dropped.
+func (c *Client) closeSend() {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+	if !c.closed {
+		c.closed = true
+		close(c.send)
+	}
+}
+
+// decodePayload decodes the payload of msg into v.
+func decodePayload(msg protocol.GenericMessage, v interface{}) error {
+	payloadBytes, err := json.Marshal(msg.Payload)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(payloadBytes, v)
+}
+
 func (c *Client) readPump() {
 	defer func() {
 		c.hub.unregister <- c
 		c.conn.Close()
 		log.Printf("readPump: Client %s (Player %s) disconnected, connection closed.", c.conn.RemoteAddr(), c.player.GetID())
 	}()
-	c.conn.SetReadLimit(maxMessageSize)
+	pongWait := c.hub.cfg.PongWait
+	c.conn.SetReadLimit(c.hub.cfg.MaxMessageSize)
 	c.conn.SetReadDeadline(time.Now().Add(pongWait))
 	c.conn.SetPongHandler(func(string) error { c.conn.SetReadDeadline(time.Now().Add(pongWait)); return nil })
 
@@ -524,6 +754,8 @@ func (c *Client) readPump() {
 }
 
 func (c *Client) writePump() {
+	writeWait := c.hub.cfg.WriteWait
+	pingPeriod := (c.hub.cfg.PongWait * 9) / 10
 	ticker := time.NewTicker(pingPeriod)
 	defer func() {
 		ticker.Stop()
@@ -557,7 +789,7 @@ func (c *Client) writePump() {
 }
 
 func ServeWs(hub *Hub, w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+	conn, err := hub.upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Printf("Failed to upgrade to websocket: %v", err)
 		return
@@ -565,30 +797,27 @@ func ServeWs(hub *Hub, w http.ResponseWriter, r *http.Request) {
 	log.Printf("Client connected: %s", conn.RemoteAddr())
 
 	playerID := fmt.Sprintf("player-%d", rand.Intn(10000))
-	var startX, startY int
-	hub.world.Mu.Lock()
-	for {
-		fmt.Printf("looking")
-		sx := rand.Intn(hub.world.Width-2) + 1
-		sy := rand.Intn(hub.world.Height-2) + 1
-		if hub.world.IsWalkable(sx, sy) && !hub.world.IsOccupiedInternal(sx, sy) {
-			startX = sx
-			startY = sy
-			fmt.Printf("found start position")
-			break
-		}
+	world := hub.dungeon.Floors[0]
+	world.Mu.Lock()
+	startX, startY, ok := world.FindPlayerSpawnInternal()
+	if !ok {
+		world.Mu.Unlock()
+		log.Printf("No free spawn tile for new client %s. Closing connection.", conn.RemoteAddr())
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "world is full"))
+		conn.Close()
+		return
 	}
 
-	player := game.NewPlayer(playerID, startX, startY)
-	hub.world.AddPlayer(player)
-	hub.world.Mu.Unlock()
+	player := game.NewPlayer(playerID, startX, startY, world.Tuning)
+	world.AddPlayer(player)
+	world.Mu.Unlock()
 
 	client := &Client{
 		hub:    hub,
 		conn:   conn,
 		send:   make(chan []byte, 256),
 		player: player,
-		world:  hub.world,
+		world:  world,
 	}
 	client.hub.register <- client
 
@@ -598,16 +827,67 @@ func ServeWs(hub *Hub, w http.ResponseWriter, r *http.Request) {
 	log.Printf("Player %s created and client pumps started for %s.", player.GetID(), conn.RemoteAddr())
 }
 
-func Start(world *game.World, port string) {
-	hub := NewHub(world)
-	world.SetHubBroadcaster(hub)
+// serveMapImage renders a live floor as a PNG. Query parameters: floor (depth,
+// default 0), tile (pixels per tile) and grid (any true value draws a grid). Requires the admin token as
+// a bearer token or a token query parameter.
+func serveMapImage(hub *Hub, w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token = strings.TrimPrefix(auth, "Bearer ")
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(hub.cfg.AdminToken)) != 1 {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	opts := mapimage.Options{}
+	if tile := r.URL.Query().Get("tile"); tile != "" {
+		size, err := strconv.Atoi(tile)
+		if err != nil || size < 1 || size > 64 {
+			http.Error(w, "tile must be between 1 and 64", http.StatusBadRequest)
+			return
+		}
+		opts.TileSize = size
+	}
+	opts.Grid, _ = strconv.ParseBool(r.URL.Query().Get("grid"))
+
+	world := hub.dungeon.Floors[0]
+	if floor := r.URL.Query().Get("floor"); floor != "" {
+		depth, err := strconv.Atoi(floor)
+		var ok bool
+		if err == nil {
+			world, ok = hub.dungeon.Floor(depth)
+		}
+		if !ok {
+			http.Error(w, "no such floor", http.StatusBadRequest)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := mapimage.Encode(w, world, opts); err != nil {
+		log.Printf("Error encoding map image: %v", err)
+	}
+}
 
-	world.SpawnInitialMonsters(5)
+func Start(dungeon *game.Dungeon, cfg *config.Config) {
+	hub := NewHub(dungeon, cfg)
+	for _, floor := range dungeon.Floors {
+		floor.SetHubBroadcaster(floorBroadcaster{hub: hub, world: floor})
+		floor.Populate(game.PopulationFromConfig(cfg))
+		go floor.Run(nil)
+	}
 
 	go hub.Run()
 	http.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
 		ServeWs(hub, w, r)
 	})
+	if cfg.AdminToken != "" {
+		http.HandleFunc("/admin/map.png", func(w http.ResponseWriter, r *http.Request) {
+			serveMapImage(hub, w, r)
+		})
+	}
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path != "/" {
 			http.NotFound(w, r)
@@ -615,8 +895,8 @@ func Start(world *game.World, port string) {
 		}
 		fmt.Fprintln(w, "Game server is running. Connect via WebSocket on /ws.")
 	})
-	log.Printf("HTTP server listening on :%s, WebSocket endpoint on /ws", port)
-	if err := http.ListenAndServe(":"+port, nil); err != nil {
+	log.Printf("HTTP server listening on :%s, WebSocket endpoint on /ws", cfg.ServerPort)
+	if err := http.ListenAndServe(":"+cfg.ServerPort, nil); err != nil {
 		log.Fatalf("Failed to start HTTP server: %v", err)
 	}
 }
@@ -2,7 +2,15 @@
 export enum TileType {
     Grass = 0,
     Stone = 1,
+    Water = 2,
+    Lava = 3,
+    Door = 4,
+    Bridge = 5,
+    Rubble = 6,
+    StairsDown = 7,
+    StairsUp = 8,
 }
+// Monster types come from the server's monster data file; these are the built-in ones.
 export enum MonsterType {
     Goblin = "Goblin",
     Orc = "Orc",
@@ -21,15 +29,45 @@ export interface C2S_MovePayload {
 	dx: number;
 	dy: number;
 }
+export type DamageType = 'physical' | 'fire' | 'frost' | 'poison';
+
 export interface C2S_AttackPayload {
 	target_id: string;
+	damage_type?: DamageType; // must match the player's weapon; usually left out
 }
 export interface C2S_UsePotionPayload {
 
 }
+export interface C2S_UseItemPayload {
+	slot: number;
+}
+export interface C2S_DropItemPayload {
+	slot: number;
+	count: number; // 0 drops the whole stack
+}
+export interface C2S_InspectItemPayload {
+	slot: number;
+}
+export interface C2S_PickupPayload {
+
+}
+export type EquipmentSlot = 'weapon' | 'armour' | 'accessory';
+export interface C2S_EquipPayload {
+	slot: number; // inventory slot
+}
+export interface C2S_UnequipPayload {
+	slot: EquipmentSlot;
+}
 
 // --- S2C Payloads & DTOs ---
-export interface S2C_TileData { type: TileType; }
+export interface S2C_TileData {
+	type: TileType;
+	name: string;
+	passable: boolean;
+	blocks_sight: boolean;
+	move_cost: number;
+	damage_per_step: number;
+}
 export interface S2C_MapData {
 	width: number;
 	height: number;
@@ -51,16 +89,60 @@ export interface S2C_MonsterData {
 	id: string;
 	x: number;
 	y: number;
-	type: MonsterType;
+	type: MonsterType | string;
 	name: string;
+	glyph: string;
 	max_hp: number;
 	current_hp: number;
 }
 export interface S2C_InitialStatePayload {
 	player_id: string;
+	seed: string; // 64-bit world seed, sent as a string to keep precision
+	floor: number; // depth of this floor, 0 being the top
+	floor_count: number;
 	map: S2C_MapData;
 	players: S2C_PlayerData[];
 	monsters: S2C_MonsterData[];
+	inventory: S2C_InventoryData;
+	ground_items: S2C_GroundItemData[];
+}
+// Sent as ground_item_added, and again with the new count when part of a stack is picked up.
+export interface S2C_GroundItemData {
+	id: string;
+	x: number;
+	y: number;
+	item_id: string;
+	name: string;
+	kind: string;
+	count: number;
+}
+export interface S2C_GroundItemRemovedPayload {
+	id: string;
+}
+export interface S2C_InventorySlotData {
+	slot: number;
+	item_id?: string;
+	name?: string;
+	kind?: 'consumable' | 'misc' | EquipmentSlot | string;
+	count: number; // 0 means the slot is empty
+}
+export interface S2C_InventoryData {
+	capacity: number;
+	slots: S2C_InventorySlotData[];
+}
+export interface S2C_InventoryUpdatePayload {
+	slots: S2C_InventorySlotData[];
+}
+export interface S2C_ItemInfoPayload extends S2C_InventorySlotData {
+	description: string;
+	max_stack: number;
+	heal?: number;
+	effect?: string;
+	cures?: string[];
+	attack_mod?: number;
+	defense_mod?: number;
+	resistances?: Partial<Record<DamageType, number>>;
+	damage_type?: DamageType;
 }
 export type S2C_PlayerJoinedPayload = S2C_PlayerData;
 export interface S2C_PlayerLeftPayload { id: string; }
@@ -82,6 +164,8 @@ export interface S2C_CombatInitiatedPayload {
 	player_y: number;
 	monster_x: number;
 	monster_y: number;
+	attacker_ids: string[];
+	monster_target_id: string;
 }
 export interface S2C_CombatUpdatePayload {
 	attacker_id: string;
@@ -89,6 +173,49 @@ export interface S2C_CombatUpdatePayload {
 	damage_dealt: number;
 	defender_current_hp: number;
 	is_defender_defeated: boolean;
+	missed: boolean;
+	critical: boolean;
+	damage_type: DamageType;
+	effectiveness: 'immune' | 'resisted' | 'normal' | 'weak';
+}
+export interface S2C_FleeResultPayload {
+	player_id: string;
+	monster_id: string;
+	escaped: boolean;
+	chance: number;
+	damage_taken: number;
+	player_current_hp: number;
+	x: number;
+	y: number;
+}
+export interface S2C_CombatEndedPayload {
+	player_id: string;
+	monster_id: string;
+	reason: 'monster_defeated' | 'player_defeated' | 'player_left' | 'monster_removed' | 'timeout' | 'fled';
+	monster_target_id: string; // empty once nobody is fighting the monster
+}
+export interface S2C_EffectAppliedPayload {
+	entity_id: string;
+	entity_type: 'player' | 'monster';
+	effect_id: string;
+	name: string;
+	source_id?: string;
+	stacks: number;
+	duration_ms: number;
+}
+export interface S2C_EffectExpiredPayload {
+	entity_id: string;
+	entity_type: 'player' | 'monster';
+	effect_id: string;
+}
+export interface S2C_EffectTickPayload {
+	entity_id: string;
+	entity_type: 'player' | 'monster';
+	effect_id: string;
+	damage: number;
+	healing: number;
+	current_hp: number;
+	is_defeated: boolean;
 }
 export interface S2C_PlayerStatUpdatePayload {
 	player_id: string;
@@ -97,8 +224,20 @@ export interface S2C_PlayerStatUpdatePayload {
 	xp_to_next_level: number;
 	max_hp: number;
 	current_hp: number;
-	attack: number;
+	attack: number; // base stats; the effective ones add equipment and effects
 	defense: number;
+	effective_attack: number;
+	effective_defense: number;
+	damage_type: DamageType; // set by the equipped weapon
+	equipment: S2C_EquippedItemData[];
+}
+export interface S2C_EquippedItemData {
+	slot: EquipmentSlot;
+	item_id: string;
+	name: string;
+	attack_mod?: number;
+	defense_mod?: number;
+	damage_type?: DamageType;
 }
 
 export interface S2C_NotificationPayload {
@@ -110,7 +249,14 @@ export interface S2C_NotificationPayload {
 // C2S
 export const C2S_MessageTypeMove = "move";
 export const C2S_MessageTypeAttack = "attack";
+export const C2S_MessageTypeFlee = "flee";
 export const C2S_MessageTypeUsePotion = "use_potion"
+export const C2S_MessageTypeUseItem = "use_item";
+export const C2S_MessageTypeDropItem = "drop_item";
+export const C2S_MessageTypeInspectItem = "inspect_item";
+export const C2S_MessageTypeEquip = "equip";
+export const C2S_MessageTypeUnequip = "unequip";
+export const C2S_MessageTypePickup = "pickup";
 
 // S2C
 export const S2C_MessageTypeInitialState = "initial_state";
@@ -121,5 +267,14 @@ export const S2C_MessageTypeMonsterSpawned = "monster_spawned";
 export const S2C_MessageTypeEntityRemoved = "entity_removed";
 export const S2C_MessageTypeCombatInitiated = "combat_initiated";
 export const S2C_MessageTypeCombatUpdate = "combat_update";
+export const S2C_MessageTypeCombatEnded = "combat_ended";
+export const S2C_MessageTypeFleeResult = "flee_result";
+export const S2C_MessageTypeEffectApplied = "effect_applied";
+export const S2C_MessageTypeEffectExpired = "effect_expired";
+export const S2C_MessageTypeEffectTick = "effect_tick";
 export const S2C_MessageTypePlayerStatUpdate = "player_stat_update";
+export const S2C_MessageTypeInventoryUpdate = "inventory_update";
+export const S2C_MessageTypeItemInfo = "item_info";
+export const S2C_MessageTypeGroundItemAdded = "ground_item_added";
+export const S2C_MessageTypeGroundItemRemoved = "ground_item_removed";
 export const S2C_MessageTypeNotification = "notification"
\ No newline at end of file
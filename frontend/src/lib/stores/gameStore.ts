@@ -1,5 +1,5 @@
 // src/lib/stores/gameStore.ts
-import { writable, type Writable } from 'svelte/store';
+import { get, writable, type Writable } from 'svelte/store';
 import {
     EntityTypeMonster,
 	EntityTypePlayer,
@@ -12,9 +12,21 @@ import {
 	type S2C_EntityMovedPayload,
 	type S2C_CombatInitiatedPayload,
 	type S2C_CombatUpdatePayload,
+	type S2C_CombatEndedPayload,
+	type S2C_FleeResultPayload,
+	type S2C_EffectAppliedPayload,
+	type S2C_EffectExpiredPayload,
+	type S2C_EffectTickPayload,
 	type S2C_EntityRemovedPayload,
+	type S2C_MonsterSpawnedPayload,
 	type S2C_PlayerStatUpdatePayload,
 	type S2C_NotificationPayload,
+	type S2C_InventorySlotData,
+	type S2C_InventoryUpdatePayload,
+	type S2C_ItemInfoPayload,
+	type S2C_EquippedItemData,
+	type S2C_GroundItemData,
+	type S2C_GroundItemRemovedPayload,
 } from '$lib/protocol/messages';
 import { websocketService } from '$lib/services/websocketService';
 import {
@@ -24,26 +36,53 @@ import {
 	S2C_MessageTypeEntityMoved,
 	S2C_MessageTypeCombatInitiated,
 	S2C_MessageTypeCombatUpdate,
+	S2C_MessageTypeCombatEnded,
+	S2C_MessageTypeFleeResult,
+	S2C_MessageTypeEffectApplied,
+	S2C_MessageTypeEffectExpired,
+	S2C_MessageTypeEffectTick,
 	S2C_MessageTypeEntityRemoved,
+	S2C_MessageTypeMonsterSpawned,
 	S2C_MessageTypePlayerStatUpdate,
 	S2C_MessageTypeNotification,
+	S2C_MessageTypeInventoryUpdate,
+	S2C_MessageTypeItemInfo,
+	S2C_MessageTypeGroundItemAdded,
+	S2C_MessageTypeGroundItemRemoved,
 } from '$lib/protocol/messages';
 
 export const selfId: Writable<string | null> = writable(null);
 export const mapData: Writable<S2C_MapData | null> = writable(null);
+export const floor: Writable<{ depth: number; count: number } | null> = writable(null);
+
+// inventory is the local player's own, one entry per slot; empty slots have count 0.
+export const inventory: Writable<S2C_InventorySlotData[]> = writable([]);
+
+export const groundItems: Writable<Map<string, S2C_GroundItemData>> = writable(new Map());
+
+export interface ActiveEffect {
+    name: string;
+    stacks: number;
+}
 
 export interface ClientPlayerData extends S2C_PlayerData {
     isInCombat?: boolean;
     combatTargetId?: string | null;
+    effects?: Record<string, ActiveEffect>;
     xp?: number;
     xpToNextLevel?: number;
     attack?: number;
     defense?: number;
+    effectiveAttack?: number;
+    effectiveDefense?: number;
+    damageType?: string;
+    equipment?: S2C_EquippedItemData[];
 }
 
 export interface ClientMonsterData extends S2C_MonsterData {
     isInCombat?: boolean;
     combatTargetId?: string | null;
+    effects?: Record<string, ActiveEffect>;
 }
 
 export const players: Writable<Map<string, ClientPlayerData>> = writable(new Map());
@@ -57,12 +96,33 @@ export interface ActiveCombatInfo {
 export const notifications: Writable<Array<{id: number, message: string, level: string}>> = writable([]);
 let notificationIdCounter = 0;
 
+// updateEntity applies fn to the player or monster with the given id, if it is known.
+function updateEntity(entityType: 'player' | 'monster', id: string, fn: (entity: ClientPlayerData | ClientMonsterData) => ClientPlayerData | ClientMonsterData) {
+	const store = entityType === 'player' ? players : monsters;
+	(store as Writable<Map<string, ClientPlayerData | ClientMonsterData>>).update(current => {
+		const entity = current.get(id);
+		if (entity) {
+			current.set(id, fn(entity));
+		}
+		return new Map(current);
+	});
+}
+
+function pushNotification(message: string, level: string) {
+	const newNotification = { id: notificationIdCounter++, message, level };
+	notifications.update(current => [newNotification, ...current.slice(0, 4)]);
+	setTimeout(() => {
+		notifications.update(current => current.filter(n => n.id !== newNotification.id));
+	}, 5000);
+}
+
 export function initializeGameStoreListeners() {
 	// Initial State
 	websocketService.onMessage<S2C_InitialStatePayload>(S2C_MessageTypeInitialState, (payload) => {
 		console.log('Received Initial State:', payload);
 		selfId.set(payload.player_id);
 		mapData.set(payload.map);
+		floor.set({ depth: payload.floor, count: payload.floor_count });
 		
 		const newPlayers = new Map<string, ClientPlayerData>();
 		payload.players.forEach(p => newPlayers.set(p.id, { ...p, isInCombat: false, combatTargetId: null }));
@@ -71,6 +131,15 @@ export function initializeGameStoreListeners() {
 		const newMonsters = new Map<string, ClientMonsterData>();
 		payload.monsters.forEach(m => newMonsters.set(m.id, { ...m, isInCombat: false, combatTargetId: null }));
 		monsters.set(newMonsters);
+
+		const slots: S2C_InventorySlotData[] = [];
+		for (let i = 0; i < payload.inventory.capacity; i++) {
+			slots.push({ slot: i, count: 0 });
+		}
+		payload.inventory.slots.forEach(s => { slots[s.slot] = s; });
+		inventory.set(slots);
+
+		groundItems.set(new Map(payload.ground_items.map(item => [item.id, item])));
 	});
 
 	// Player Joined
@@ -129,18 +198,68 @@ export function initializeGameStoreListeners() {
 		monsters.update(currentMonsters => {
 			const monster = currentMonsters.get(payload.monster_id);
 			if (monster) {
-				currentMonsters.set(payload.monster_id, { ...monster, isInCombat: true, combatTargetId: payload.player_id });
+				currentMonsters.set(payload.monster_id, { ...monster, isInCombat: true, combatTargetId: payload.monster_target_id });
 			}
 			return new Map(currentMonsters);
 		});
 	});
 
+	// Combat Ended
+	websocketService.onMessage<S2C_CombatEndedPayload>(S2C_MessageTypeCombatEnded, (payload) => {
+		console.log('Combat Ended:', payload);
+		players.update(currentPlayers => {
+			const player = currentPlayers.get(payload.player_id);
+			if (player && player.combatTargetId === payload.monster_id) {
+				currentPlayers.set(payload.player_id, { ...player, isInCombat: false, combatTargetId: null });
+			}
+			return new Map(currentPlayers);
+		});
+		monsters.update(currentMonsters => {
+			const monster = currentMonsters.get(payload.monster_id);
+			if (monster) {
+				// Other players may still be fighting it; the server says who it turns to next.
+				const target = payload.monster_target_id || null;
+				currentMonsters.set(payload.monster_id, { ...monster, isInCombat: target !== null, combatTargetId: target });
+			}
+			return new Map(currentMonsters);
+		});
+	});
+
+	// Flee Result
+	websocketService.onMessage<S2C_FleeResultPayload>(S2C_MessageTypeFleeResult, (payload) => {
+		console.log('Flee Result:', payload);
+		players.update(currentPlayers => {
+			const player = currentPlayers.get(payload.player_id);
+			if (player) {
+				currentPlayers.set(payload.player_id, { ...player, current_hp: payload.player_current_hp });
+			}
+			return new Map(currentPlayers);
+		});
+	});
+
 	// Combat Update
 	websocketService.onMessage<S2C_CombatUpdatePayload>(S2C_MessageTypeCombatUpdate, (payload) => {
 		console.log('Combat Update:', payload);
 		const defenderIsPlayer = payload.defender_id.startsWith('player-');
 		const attackerIsPlayer = payload.attacker_id.startsWith('player-');
 
+		const me = get(selfId);
+		if (me && (payload.missed || payload.critical) && (payload.attacker_id === me || payload.defender_id === me)) {
+			if (payload.attacker_id === me) {
+				pushNotification(payload.missed ? 'You missed!' : `Critical hit for ${payload.damage_dealt}!`, payload.missed ? 'info' : 'success');
+			} else {
+				pushNotification(payload.missed ? 'The attack missed you.' : `Critical hit! You took ${payload.damage_dealt}.`, payload.missed ? 'info' : 'error');
+			}
+		}
+		if (me && payload.attacker_id === me && !payload.missed && payload.effectiveness !== 'normal') {
+			const effectivenessText = {
+				immune: `It is immune to ${payload.damage_type}!`,
+				resisted: `It resists ${payload.damage_type}.`,
+				weak: `It is weak to ${payload.damage_type}!`,
+			}[payload.effectiveness];
+			pushNotification(effectivenessText, payload.effectiveness === 'weak' ? 'success' : 'warning');
+		}
+
 		if (defenderIsPlayer) {
 			players.update(currentPlayers => {
 				const player = currentPlayers.get(payload.defender_id);
@@ -188,6 +307,38 @@ export function initializeGameStoreListeners() {
 		}
 	});
 
+	// Status effects
+	websocketService.onMessage<S2C_EffectAppliedPayload>(S2C_MessageTypeEffectApplied, (payload) => {
+		updateEntity(payload.entity_type, payload.entity_id, entity => ({
+			...entity,
+			effects: { ...entity.effects, [payload.effect_id]: { name: payload.name, stacks: payload.stacks } },
+		}));
+		if (payload.entity_id === get(selfId)) {
+			pushNotification(`You are affected by ${payload.name}.`, 'warning');
+		}
+	});
+
+	websocketService.onMessage<S2C_EffectExpiredPayload>(S2C_MessageTypeEffectExpired, (payload) => {
+		updateEntity(payload.entity_type, payload.entity_id, entity => {
+			const effects = { ...entity.effects };
+			delete effects[payload.effect_id];
+			return { ...entity, effects };
+		});
+	});
+
+	websocketService.onMessage<S2C_EffectTickPayload>(S2C_MessageTypeEffectTick, (payload) => {
+		updateEntity(payload.entity_type, payload.entity_id, entity => ({ ...entity, current_hp: payload.current_hp }));
+	});
+
+	// Monster Spawned
+	websocketService.onMessage<S2C_MonsterSpawnedPayload>(S2C_MessageTypeMonsterSpawned, (payload) => {
+		console.log('Monster Spawned:', payload);
+		monsters.update(currentMonsters => {
+			currentMonsters.set(payload.id, { ...payload, isInCombat: false, combatTargetId: null });
+			return new Map(currentMonsters);
+		});
+	});
+
 	// Entity Removed
 	websocketService.onMessage<S2C_EntityRemovedPayload>(S2C_MessageTypeEntityRemoved, (payload) => {
 		console.log('Entity Removed:', payload);
@@ -226,6 +377,10 @@ export function initializeGameStoreListeners() {
 				player.current_hp = payload.current_hp;
 				player.attack = payload.attack;
 				player.defense = payload.defense;
+				player.effectiveAttack = payload.effective_attack;
+				player.effectiveDefense = payload.effective_defense;
+				player.damageType = payload.damage_type;
+				player.equipment = payload.equipment;
 				
 				currentPlayers.set(payload.player_id, { ...player }); 
 			}
@@ -233,13 +388,46 @@ export function initializeGameStoreListeners() {
 		});
 	});
 
+	// Inventory Update
+	websocketService.onMessage<S2C_InventoryUpdatePayload>(S2C_MessageTypeInventoryUpdate, (payload) => {
+		inventory.update(current => {
+			payload.slots.forEach(s => { current[s.slot] = s; });
+			return [...current];
+		});
+	});
+
+	// Ground Items
+	websocketService.onMessage<S2C_GroundItemData>(S2C_MessageTypeGroundItemAdded, (payload) => {
+		groundItems.update(current => {
+			current.set(payload.id, payload);
+			return new Map(current);
+		});
+	});
+	websocketService.onMessage<S2C_GroundItemRemovedPayload>(S2C_MessageTypeGroundItemRemoved, (payload) => {
+		groundItems.update(current => {
+			current.delete(payload.id);
+			return new Map(current);
+		});
+	});
+
+	// Item Info
+	websocketService.onMessage<S2C_ItemInfoPayload>(S2C_MessageTypeItemInfo, (payload) => {
+		const details = [`${payload.name} (${payload.count}/${payload.max_stack}): ${payload.description}`];
+		if (payload.heal) details.push(`Heals ${payload.heal} HP.`);
+		if (payload.effect) details.push(`Grants ${payload.effect}.`);
+		if (payload.cures?.length) details.push(`Cures ${payload.cures.join(', ')}.`);
+		if (payload.damage_type) details.push(`Deals ${payload.damage_type} damage.`);
+		if (payload.attack_mod) details.push(`Attack ${payload.attack_mod > 0 ? '+' : ''}${payload.attack_mod}.`);
+		if (payload.defense_mod) details.push(`Defense ${payload.defense_mod > 0 ? '+' : ''}${payload.defense_mod}.`);
+		Object.entries(payload.resistances ?? {}).forEach(([type, value]) => {
+			details.push(`${Math.round(value * 100)}% ${type} resistance.`);
+		});
+		pushNotification(details.join(' '), 'info');
+	});
+
 	// Notification
 	websocketService.onMessage<S2C_NotificationPayload>(S2C_MessageTypeNotification, (payload) => {
 		console.log('Notification:', payload.message, `(${payload.level})`);
-		const newNotification = { id: notificationIdCounter++, message: payload.message, level: payload.level };
-		notifications.update(current => [newNotification, ...current.slice(0, 4)]);
-		setTimeout(() => {
-			notifications.update(current => current.filter(n => n.id !== newNotification.id));
-		}, 5000);
+		pushNotification(payload.message, payload.level);
 	});
 }
\ No newline at end of file